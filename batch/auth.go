@@ -0,0 +1,148 @@
+package batch
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Events of RecordAuth.
+const (
+	AuthEventLogin        = "login"
+	AuthEventAuth         = "auth"
+	AuthEventSessionOpen  = "session_open"
+	AuthEventSessionClose = "session_close"
+	AuthEventSudo         = "sudo"
+	AuthEventSu           = "su"
+)
+
+// Outcomes of RecordAuth.
+const (
+	AuthSuccess = "success"
+	AuthFailure = "failure"
+)
+
+// RecordAuth is the normalized authentication or privilege event of sshd, sudo, su and pam_unix messages. User is the
+// user who logs in or runs the command, TargetUser is the user the command runs as. Method is the sshd authentication
+// method, e.g. publickey, or the PAM service of pam_unix messages, e.g. sshd.
+type RecordAuth struct {
+	Event      string `json:"event"`
+	Outcome    string `json:"outcome"`
+	User       string `json:"user,omitempty"`
+	TargetUser string `json:"targetUser,omitempty"`
+	SourceIP   string `json:"sourceIp,omitempty"`
+	Method     string `json:"method,omitempty"`
+	Command    string `json:"command,omitempty"`
+}
+
+// authMatcher recognizes the messages of the programs by pattern, and builds the event from the submatches.
+type authMatcher struct {
+	// programs are the syslog identifiers or commands of the messages, any program if empty.
+	programs []string
+	pattern  *regexp.Regexp
+	event    func(m []string) *RecordAuth
+}
+
+var sshdPrograms = []string{"sshd", "sshd-session"}
+
+var authMatchers = []authMatcher{
+	{
+		programs: sshdPrograms,
+		pattern:  regexp.MustCompile(`^(Accepted|Failed) (\S+) for (?:invalid user )?(\S+) from (\S+) port \d+`),
+		event: func(m []string) *RecordAuth {
+			outcome := AuthSuccess
+			if m[1] == "Failed" {
+				outcome = AuthFailure
+			}
+			return &RecordAuth{Event: AuthEventLogin, Outcome: outcome, Method: m[2], User: m[3], SourceIP: m[4]}
+		},
+	},
+	{
+		programs: sshdPrograms,
+		pattern:  regexp.MustCompile(`^Invalid user (\S*) from (\S+)`),
+		event: func(m []string) *RecordAuth {
+			return &RecordAuth{Event: AuthEventLogin, Outcome: AuthFailure, User: m[1], SourceIP: m[2]}
+		},
+	},
+	{
+		// e.g. "alice : TTY=pts/0 ; PWD=/home/alice ; USER=root ; COMMAND=/usr/bin/ls", with the reason of the
+		// failure, e.g. "3 incorrect password attempts ; ", before TTY if the command is not run.
+		programs: []string{"sudo"},
+		pattern: regexp.MustCompile(
+			`^\s*(\S+) : (?:([^=;]+) ; )?(?:TTY=\S+ ; )?PWD=.*? ; USER=(\S+) ;.*?COMMAND=(.*)$`),
+		event: func(m []string) *RecordAuth {
+			outcome := AuthSuccess
+			if m[2] != "" {
+				outcome = AuthFailure
+			}
+			return &RecordAuth{Event: AuthEventSudo, Outcome: outcome, User: m[1], TargetUser: m[3], Command: m[4]}
+		},
+	},
+	{
+		// e.g. "(to root) alice on pts/0" or "FAILED SU (to root) alice on pts/0".
+		programs: []string{"su"},
+		pattern:  regexp.MustCompile(`^(FAILED SU )?\(to (\S+)\) (\S+) on`),
+		event: func(m []string) *RecordAuth {
+			outcome := AuthSuccess
+			if m[1] != "" {
+				outcome = AuthFailure
+			}
+			return &RecordAuth{Event: AuthEventSu, Outcome: outcome, User: m[3], TargetUser: m[2]}
+		},
+	},
+	{
+		// e.g. "pam_unix(sshd:session): session opened for user alice(uid=1000) by (uid=0)".
+		pattern: regexp.MustCompile(`^pam_unix\(([^:]+):session\): session (opened|closed) for user ([^\s(]+)`),
+		event: func(m []string) *RecordAuth {
+			event := AuthEventSessionOpen
+			if m[2] == "closed" {
+				event = AuthEventSessionClose
+			}
+			return &RecordAuth{Event: event, Outcome: AuthSuccess, Method: m[1], User: m[3]}
+		},
+	},
+	{
+		// e.g. "pam_unix(sshd:auth): authentication failure; logname= uid=0 euid=0 tty=ssh ruser= rhost=192.0.2.1
+		// user=alice". user is missing if the user is unknown.
+		pattern: regexp.MustCompile(`^pam_unix\(([^:]+):auth\): authentication failure;(.*)$`),
+		event: func(m []string) *RecordAuth {
+			pairs := authPairs(m[2])
+			return &RecordAuth{
+				Event:    AuthEventAuth,
+				Outcome:  AuthFailure,
+				Method:   m[1],
+				User:     pairs["user"],
+				SourceIP: pairs["rhost"],
+			}
+		},
+	},
+}
+
+// authEvent returns the authentication or privilege event of the record, or nil if the message is not one. The program
+// is the syslog identifier, or the command if the entry has no identifier.
+func authEvent(r *Record) *RecordAuth {
+	program := r.Syslog.Identifier
+	if program == "" {
+		program = r.Command
+	}
+	for _, matcher := range authMatchers {
+		if len(matcher.programs) > 0 && !slices.Contains(matcher.programs, program) {
+			continue
+		}
+		if m := matcher.pattern.FindStringSubmatch(r.Message); m != nil {
+			return matcher.event(m)
+		}
+	}
+	return nil
+}
+
+// authPairs returns the key=value pairs of the PAM message, e.g. "logname= uid=0 rhost=192.0.2.1".
+func authPairs(s string) map[string]string {
+	pairs := make(map[string]string)
+	for _, word := range strings.Fields(s) {
+		if k, v, ok := strings.Cut(word, "="); ok && v != "" {
+			pairs[k] = v
+		}
+	}
+	return pairs
+}
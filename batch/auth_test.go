@@ -0,0 +1,133 @@
+package batch
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/sdjournal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthEvent(t *testing.T) {
+	cases := []struct {
+		name       string
+		identifier string
+		command    string
+		message    string
+		expected   *RecordAuth
+	}{
+		{
+			name:       "ssh login",
+			identifier: "sshd",
+			message:    "Accepted publickey for alice from 192.0.2.1 port 52000 ssh2: ED25519 SHA256:abc",
+			expected: &RecordAuth{Event: AuthEventLogin, Outcome: AuthSuccess, User: "alice", SourceIP: "192.0.2.1",
+				Method: "publickey"},
+		},
+		{
+			name:       "failed ssh login of invalid user",
+			identifier: "sshd-session",
+			message:    "Failed password for invalid user admin from 192.0.2.2 port 40000 ssh2",
+			expected: &RecordAuth{Event: AuthEventLogin, Outcome: AuthFailure, User: "admin", SourceIP: "192.0.2.2",
+				Method: "password"},
+		},
+		{
+			name:       "invalid ssh user",
+			identifier: "sshd",
+			message:    "Invalid user admin from 192.0.2.2 port 40000",
+			expected:   &RecordAuth{Event: AuthEventLogin, Outcome: AuthFailure, User: "admin", SourceIP: "192.0.2.2"},
+		},
+		{
+			name:    "ssh login by command",
+			command: "sshd",
+			message: "Accepted password for bob from 2001:db8::1 port 22 ssh2",
+			expected: &RecordAuth{Event: AuthEventLogin, Outcome: AuthSuccess, User: "bob", SourceIP: "2001:db8::1",
+				Method: "password"},
+		},
+		{
+			name:       "sudo",
+			identifier: "sudo",
+			message:    "   alice : TTY=pts/0 ; PWD=/home/alice ; USER=root ; COMMAND=/usr/bin/systemctl restart nginx",
+			expected: &RecordAuth{Event: AuthEventSudo, Outcome: AuthSuccess, User: "alice", TargetUser: "root",
+				Command: "/usr/bin/systemctl restart nginx"},
+		},
+		{
+			name:       "failed sudo",
+			identifier: "sudo",
+			message:    "bob : user NOT in sudoers ; TTY=pts/1 ; PWD=/home/bob ; USER=root ; COMMAND=/bin/cat /etc/shadow",
+			expected: &RecordAuth{Event: AuthEventSudo, Outcome: AuthFailure, User: "bob", TargetUser: "root",
+				Command: "/bin/cat /etc/shadow"},
+		},
+		{
+			name:       "su",
+			identifier: "su",
+			message:    "(to root) alice on pts/0",
+			expected:   &RecordAuth{Event: AuthEventSu, Outcome: AuthSuccess, User: "alice", TargetUser: "root"},
+		},
+		{
+			name:       "failed su",
+			identifier: "su",
+			message:    "FAILED SU (to root) alice on pts/0",
+			expected:   &RecordAuth{Event: AuthEventSu, Outcome: AuthFailure, User: "alice", TargetUser: "root"},
+		},
+		{
+			name:       "session opened",
+			identifier: "sshd",
+			message:    "pam_unix(sshd:session): session opened for user alice(uid=1000) by (uid=0)",
+			expected:   &RecordAuth{Event: AuthEventSessionOpen, Outcome: AuthSuccess, User: "alice", Method: "sshd"},
+		},
+		{
+			name:       "session closed",
+			identifier: "sudo",
+			message:    "pam_unix(sudo:session): session closed for user root",
+			expected:   &RecordAuth{Event: AuthEventSessionClose, Outcome: AuthSuccess, User: "root", Method: "sudo"},
+		},
+		{
+			name:       "authentication failure",
+			identifier: "su",
+			message: "pam_unix(su:auth): authentication failure; logname=alice uid=1000 euid=0 tty=pts/0 ruser=alice " +
+				"rhost=  user=root",
+			expected: &RecordAuth{Event: AuthEventAuth, Outcome: AuthFailure, User: "root", Method: "su"},
+		},
+		{
+			name:       "remote authentication failure",
+			identifier: "sshd",
+			message: "pam_unix(sshd:auth): authentication failure; logname= uid=0 euid=0 tty=ssh ruser= " +
+				"rhost=192.0.2.3  user=alice",
+			expected: &RecordAuth{Event: AuthEventAuth, Outcome: AuthFailure, User: "alice", SourceIP: "192.0.2.3",
+				Method: "sshd"},
+		},
+		{
+			name:       "other sshd message",
+			identifier: "sshd",
+			message:    "Server listening on 0.0.0.0 port 22.",
+		},
+		{
+			name:       "login message of another program",
+			identifier: "app",
+			message:    "Accepted password for alice from 192.0.2.1 port 22 ssh2",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := Record{Command: tc.command, Message: tc.message, Syslog: RecordSyslog{Identifier: tc.identifier}}
+			assert.Equal(t, tc.expected, authEvent(&r))
+		})
+	}
+}
+
+func TestEntryToEventConverterWithAuthEvents(t *testing.T) {
+	entry := &sdjournal.JournalEntry{Fields: map[string]string{
+		"SYSLOG_IDENTIFIER": "su",
+		"_COMM":             "su",
+		"MESSAGE":           "(to root) alice on pts/0",
+	}}
+
+	converter := NewEntryToEventConverter(dummyInstanceID, time.Now, WithAuthEvents())
+	var r Record
+	assert.NoError(t, json.Unmarshal([]byte(*converter(entry)[0].Message), &r))
+	assert.Equal(t, &RecordAuth{Event: AuthEventSu, Outcome: AuthSuccess, User: "alice", TargetUser: "root"}, r.Auth)
+
+	converter = NewEntryToEventConverter(dummyInstanceID, time.Now)
+	assert.NotContains(t, *converter(entry)[0].Message, `"auth"`)
+}
@@ -2,24 +2,19 @@ package batch
 
 import (
 	"context"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
 	"github.com/coreos/go-systemd/v22/sdjournal"
 	"go.uber.org/zap"
+
+	"snappydevtools.com/journald-to-cwl/journal"
 )
 
 const (
-	// The maximum CWL batch sizeis 1,048,576 bytes. "This size is calculated as the sum of all event messages in UTF-8,
-	// plus 26 bytes for each log event. This quota can't be changed."
-	// https://docs.aws.amazon.com/AmazonCloudWatch/latest/logs/cloudwatch_limits_cwl.html
-	maxCWLBatchSize = 1024 * 1024 * 9 / 10
-
-	// For a CWL LogEvent whose messge is biggeer than maxCWLBatchSize, keep a few leading bytes.
-	// bytesToKeepForLogEvent must be less than maxCWLBatchSize
-	bytesToKeepForLogEvent = 500
-
 	maxBatchEvents = 1000
 
 	maxBatchWait = 2 * time.Second
@@ -32,6 +27,29 @@ type Batch struct {
 	// Cursor is the cursor of the last journal entry. "In journald, a cursor is an opaque text string that uniquely
 	// describes the position of an entry in the journal and is portable across machines, platforms and journal files."
 	Cursor string
+
+	// EntryID is the id of the entry of the last log event, see Record.EntryID, or "" if the log event does not have it,
+	// e.g. in FormatShort.
+	EntryID string
+}
+
+// eventsByTimestamp sorts the log events of a batch and the ids of their entries by timestamp.
+type eventsByTimestamp struct {
+	events   []types.InputLogEvent
+	entryIDs []string
+}
+
+func (s eventsByTimestamp) Len() int {
+	return len(s.events)
+}
+
+func (s eventsByTimestamp) Less(i, j int) bool {
+	return aws.ToInt64(s.events[i].Timestamp) < aws.ToInt64(s.events[j].Timestamp)
+}
+
+func (s eventsByTimestamp) Swap(i, j int) {
+	s.events[i], s.events[j] = s.events[j], s.events[i]
+	s.entryIDs[i], s.entryIDs[j] = s.entryIDs[j], s.entryIDs[i]
 }
 
 // Batcher tranforms journal entries into log events and batches log events into, you guessed it, batches.
@@ -41,7 +59,7 @@ type Batcher struct {
 
 	batches chan *Batch
 
-	// Maximum total bytes of all messages in one batch.
+	// Maximum total bytes of all log events in one batch, counted like maxCWLBatchSize.
 	maxPayload int
 
 	// Maximum number of log events in one batch.
@@ -49,6 +67,9 @@ type Batcher struct {
 
 	// Maximum time to wait for a batch.
 	MaxWait time.Duration
+
+	// The cursor that the entries are read after, see WithLastCursor.
+	lastCursor string
 }
 
 func NewBatcher(
@@ -70,29 +91,44 @@ func NewBatcher(
 	return &b
 }
 
-// Batches returns a channel of Batch. The returned channel is never closed.
+// Batches returns a channel of Batch. The returned channel is closed only when the entries channel is closed, after
+// the last batch is delivered.
 func (b *Batcher) Batches() <-chan *Batch {
 	return b.batches
 }
 
-// Batch batches entries untile the ctx is canceled. Batch should be called only once per batcher.
+// Batch batches entries untile the ctx is canceled or the entries channel is closed. Batch should be called only once
+// per batcher. Batches are valid for PutLogEvents, see limits.go: each log event is fit with fitEvent or dropped, a new
+// batch is started when the event would exceed the size, count or span of the batch, and log events of a batch are
+// sorted by timestamp.
 func (b *Batcher) Batch(ctx context.Context) {
 	bytesCount := 0
+	// The oldest and the newest timestamps in the batch, in milliseconds.
+	var oldest, newest int64
+	// The cursor of the last entry whose log events are all batched.
+	cursor := b.lastCursor
 	ticker := time.NewTicker(b.MaxWait)
 	defer ticker.Stop()
 	var batch *Batch
+	// The entry ids of the log events in the batch.
+	var entryIDs []string
 
 	saveOldBatch := func() {
 		if len(batch.Events) == 0 {
 			return
 		}
+		// Entries are read in journal order, which is not always the timestamp order, e.g. with source timestamps.
+		sort.Stable(eventsByTimestamp{events: batch.Events, entryIDs: entryIDs})
+		batch.EntryID = entryIDs[len(entryIDs)-1]
 		b.batches <- batch
 	}
 
 	startNewBatch := func() {
 		batch = &Batch{
 			Events: make([]types.InputLogEvent, 0, b.maxEvents),
+			Cursor: cursor,
 		}
+		entryIDs = make([]string, 0, b.maxEvents)
 		bytesCount = 0
 		ticker.Reset(b.MaxWait)
 	}
@@ -107,41 +143,68 @@ func (b *Batcher) Batch(ctx context.Context) {
 		case <-ticker.C:
 			saveOldBatch()
 			startNewBatch()
-		case entry := <-b.entries:
-			event := b.converter(entry)
-			if event.Message == nil {
-				// this should never happen.
-				zap.S().Error("input log event message should never be nil")
-				continue
-			}
-			msgSize := len(*event.Message)
-			// Rare case. For single entry that's too big, keep only the first 500 bytes.
-			if msgSize > maxCWLBatchSize {
-				event.Message = aws.String((*event.Message)[:bytesToKeepForLogEvent])
-				msgSize = len(*event.Message)
-			}
-			if msgSize+bytesCount > b.maxPayload || len(batch.Events) == b.maxEvents {
+		case entry, ok := <-b.entries:
+			if !ok {
 				saveOldBatch()
-				startNewBatch()
+				close(b.batches)
+				return
 			}
-			batch.Events = append(batch.Events, event)
-			batch.Cursor = entry.Cursor
-			bytesCount += msgSize
+			id := entryID(journal.EntryCursor(entry))
+			for _, event := range b.converter(entry) {
+				if event.Message == nil {
+					// this should never happen.
+					zap.S().Error("input log event message should never be nil")
+					continue
+				}
+				if !fitEvent(&event, time.Now()) {
+					// CWL would reject the whole batch. NewEntryToEventConverter never returns such a log event, it
+					// returns a placeholder instead, see fitRecord.
+					zap.S().Errorf("drop log event of %d bytes over the limit of %d bytes, cursor %s", eventSize(event),
+						maxCWLEventSize, entry.Cursor)
+					continue
+				}
+				// The size of the encoded log event, which depends on the format.
+				size := eventSize(event)
+				ts := aws.ToInt64(event.Timestamp)
+				if size+bytesCount > b.maxPayload || len(batch.Events) == b.maxEvents ||
+					len(batch.Events) > 0 && max(newest, ts)-min(oldest, ts) > maxBatchSpan.Milliseconds() {
+					saveOldBatch()
+					startNewBatch()
+				}
+				if len(batch.Events) == 0 {
+					oldest, newest = ts, ts
+				}
+				oldest, newest = min(oldest, ts), max(newest, ts)
+				batch.Events = append(batch.Events, event)
+				if strings.Contains(aws.ToString(event.Message), id) {
+					entryIDs = append(entryIDs, id)
+				} else {
+					entryIDs = append(entryIDs, "")
+				}
+				bytesCount += size
+			}
+			// The cursor advances only when all log events of the entry are batched. If the log events of a split
+			// message span batches, the batches before the last one keep the cursor of the entry before, so the entry
+			// is read again if it is not written completely.
+			cursor = entry.Cursor
+			batch.Cursor = cursor
 		}
 	}
 }
 
 type Option func(*Batcher)
 
+// WithMaxPayload sets the maximum bytes of one batch, up to maxCWLBatchSize.
 func WithMaxPayload(maxPayload int) Option {
 	return func(b *Batcher) {
-		b.maxPayload = maxPayload
+		b.maxPayload = min(maxPayload, maxCWLBatchSize)
 	}
 }
 
+// WithMaxEvents sets the maximum number of log events in one batch, up to maxCWLBatchEvents.
 func WithMaxEvents(maxEvents int) Option {
 	return func(b *Batcher) {
-		b.maxEvents = maxEvents
+		b.maxEvents = min(maxEvents, maxCWLBatchEvents)
 	}
 }
 
@@ -150,3 +213,11 @@ func WithMaxWait(maxWait time.Duration) Option {
 		b.MaxWait = maxWait
 	}
 }
+
+// WithLastCursor sets the cursor that the entries are read after, e.g. the saved cursor on restart. It is the cursor of
+// batches that have none of the log events of an entry that spans batches, so saving it does not move the saved cursor.
+func WithLastCursor(cursor string) Option {
+	return func(b *Batcher) {
+		b.lastCursor = cursor
+	}
+}
@@ -2,7 +2,9 @@ package batch
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -10,6 +12,8 @@ import (
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
 	"github.com/coreos/go-systemd/v22/sdjournal"
 	"github.com/stretchr/testify/assert"
+
+	"snappydevtools.com/journald-to-cwl/journal"
 )
 
 var dummyInstanceID = "i-11111111111111111"
@@ -22,11 +26,306 @@ func TestEntryToEventConverter(t *testing.T) {
 	cursor := "cursor-0"
 	converter := NewEntryToEventConverter(dummyInstanceID, now)
 	entry, expectedEvent := getExampleEntryAndEvent(dummyInstanceID, timeUnixMilli, cursor)
-	event := converter(entry)
+	event := converter(entry)[0]
 	assert.JSONEq(t, *expectedEvent.Message, *event.Message)
 	assert.Equal(t, *(expectedEvent.Timestamp), *(event.Timestamp))
 }
 
+// TestEntryToEventConverterEntryID tests that entries with the same message and timestamp have different log events.
+func TestEntryToEventConverterEntryID(t *testing.T) {
+	timeUnixMilli := time.UnixMilli(int64(1722650790111))
+	now := func() time.Time {
+		return timeUnixMilli
+	}
+	for _, format := range []string{FormatJSON, FormatLogfmt} {
+		converter := NewEntryToEventConverter(dummyInstanceID, now, WithFormat(format))
+		entry0, _ := getExampleEntryAndEvent(dummyInstanceID, timeUnixMilli, "cursor-0")
+		entry1, _ := getExampleEntryAndEvent(dummyInstanceID, timeUnixMilli, "cursor-1")
+		assert.NotEqual(t, *converter(entry0)[0].Message, *converter(entry1)[0].Message, format)
+
+		// Entries delivered with the cursor of an earlier entry are told apart by their own cursors.
+		entry1.Cursor = "cursor-0"
+		entry1.Fields[journal.EntryCursorField] = "cursor-1"
+		assert.NotEqual(t, *converter(entry0)[0].Message, *converter(entry1)[0].Message, format)
+	}
+}
+
+func TestEntryToEventConverterWithNamespace(t *testing.T) {
+	timeUnixMilli := time.UnixMilli(int64(1722650790111))
+	now := func() time.Time {
+		return timeUnixMilli
+	}
+	converter := NewEntryToEventConverter(dummyInstanceID, now, WithNamespace("foo"))
+	entry, _ := getExampleEntryAndEvent(dummyInstanceID, timeUnixMilli, "cursor-0")
+	event := converter(entry)[0]
+	var r Record
+	assert.NoError(t, json.Unmarshal([]byte(*event.Message), &r))
+	assert.Equal(t, "foo", r.Namespace)
+}
+
+func TestEntryToEventConverterWithOrigin(t *testing.T) {
+	timeUnixMilli := time.UnixMilli(int64(1722650790111))
+	now := func() time.Time {
+		return timeUnixMilli
+	}
+	converter := NewEntryToEventConverter(dummyInstanceID, now, WithOrigin("user:1000"))
+	entry, _ := getExampleEntryAndEvent(dummyInstanceID, timeUnixMilli, "cursor-0")
+	event := converter(entry)[0]
+	var r Record
+	assert.NoError(t, json.Unmarshal([]byte(*event.Message), &r))
+	assert.Equal(t, "user:1000", r.Origin)
+}
+
+func TestEntryToEventConverterWithContainer(t *testing.T) {
+	converter := NewEntryToEventConverter(dummyInstanceID, time.Now, WithIncludeFields(AllFields))
+	event := converter(&sdjournal.JournalEntry{Fields: map[string]string{
+		"MESSAGE":           "hit",
+		"CONTAINER_NAME":    "web",
+		"CONTAINER_ID":      "0123456789ab",
+		"CONTAINER_ID_FULL": "0123456789abcdef",
+		"CONTAINER_TAG":     "web-tag",
+		"IMAGE_NAME":        "nginx:1.27",
+	}})[0]
+	var r Record
+	assert.NoError(t, json.Unmarshal([]byte(*event.Message), &r))
+	assert.Equal(t, &RecordContainer{Name: "web", ID: "0123456789ab", Tag: "web-tag", Image: "nginx:1.27"}, r.Container)
+	// The container fields are not repeated in fields.
+	assert.Equal(t, map[string]string{"CONTAINER_ID_FULL": "0123456789abcdef"}, r.Fields)
+
+	event = converter(&sdjournal.JournalEntry{Fields: map[string]string{"MESSAGE": "hit"}})[0]
+	assert.NotContains(t, *event.Message, "container")
+}
+
+func TestEntryToEventConverterWithGap(t *testing.T) {
+	timeUnixMilli := time.UnixMilli(int64(1722650790111))
+	now := func() time.Time {
+		return timeUnixMilli
+	}
+	converter := NewEntryToEventConverter(dummyInstanceID, now)
+	entry := &sdjournal.JournalEntry{
+		Fields: map[string]string{
+			"MESSAGE":             "journald-to-cwl detected 10 missing journal entries",
+			journal.GapFromField:  "1722650790111473",
+			journal.GapToField:    "1722650800111473",
+			journal.GapCountField: "10",
+		},
+	}
+	event := converter(entry)[0]
+	var r Record
+	assert.NoError(t, json.Unmarshal([]byte(*event.Message), &r))
+	assert.Equal(t, &RecordGap{
+		FromRealtimeTimestamp: 1722650790111473,
+		ToRealtimeTimestamp:   1722650800111473,
+		EstimatedCount:        10,
+	}, r.Gap)
+}
+
+func TestEntryToEventConverterWithBinaryMessage(t *testing.T) {
+	cases := []struct {
+		encoding         string
+		expectedMessage  string
+		expectedEncoding string
+	}{
+		{BinaryEncodingReplace, "a\uFFFDb", BinaryEncodingReplace},
+		{BinaryEncodingBase64, "Yf9i", BinaryEncodingBase64},
+		{BinaryEncodingHex, "61ff62", BinaryEncodingHex},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.encoding, func(t *testing.T) {
+			converter := NewEntryToEventConverter(dummyInstanceID, time.Now, WithBinaryEncoding(tc.encoding))
+			event := converter(&sdjournal.JournalEntry{Fields: map[string]string{"MESSAGE": "a\xffb"}})[0]
+			var r Record
+			assert.NoError(t, json.Unmarshal([]byte(*event.Message), &r))
+			assert.Equal(t, tc.expectedMessage, r.Message)
+			assert.Equal(t, tc.expectedEncoding, r.MessageEncoding)
+		})
+	}
+}
+
+// TestEntryToEventConverterWithTruncatedField tests that entries marked by the assembler as reaching the data threshold
+// are truncated, and that the mark is not a field of the record.
+func TestEntryToEventConverterWithTruncatedField(t *testing.T) {
+	converter := NewEntryToEventConverter(dummyInstanceID, time.Now, WithIncludeFields(AllFields))
+	for _, truncated := range []bool{false, true} {
+		entry := &sdjournal.JournalEntry{Fields: map[string]string{"MESSAGE": "long message"}}
+		if truncated {
+			entry.Fields[journal.TruncatedField] = "true"
+		}
+		event := converter(entry)[0]
+		var r Record
+		assert.NoError(t, json.Unmarshal([]byte(*event.Message), &r))
+		assert.Equal(t, "long message", r.Message)
+		assert.Equal(t, truncated, r.Truncated)
+		assert.Nil(t, r.Fields)
+	}
+}
+
+func TestEntryToEventConverterWithMaxMessageSize(t *testing.T) {
+	converter := NewEntryToEventConverter(dummyInstanceID, time.Now, WithMaxMessageSize(8))
+	cases := []struct {
+		message                string
+		expectedMessage        string
+		expectedOriginalLength int
+	}{
+		{"short", "short", 0},
+		{"exactly8", "exactly8", 0},
+		{"long message", "long mes", 12},
+		// "é" is 2 bytes and would be cut in half at 8 bytes.
+		{"1234567é", "1234567", 9},
+	}
+	for _, tc := range cases {
+		entry := &sdjournal.JournalEntry{Fields: map[string]string{"MESSAGE": tc.message, "_HOSTNAME": "host"}}
+		event := converter(entry)[0]
+		var r Record
+		assert.NoError(t, json.Unmarshal([]byte(*event.Message), &r), tc.message)
+		assert.Equal(t, tc.expectedMessage, r.Message, tc.message)
+		assert.Equal(t, tc.expectedOriginalLength > 0, r.Truncated, tc.message)
+		assert.Equal(t, tc.expectedOriginalLength, r.OriginalLength, tc.message)
+		assert.Equal(t, "host", r.Hostname, tc.message)
+	}
+}
+
+// TestEntryToEventConverterFitsEncodedRecord tests that the message is cut until the encoded record fits in a log
+// event, even if the message fits in the maximum message size.
+func TestEntryToEventConverterFitsEncodedRecord(t *testing.T) {
+	cases := []struct {
+		name     string
+		message  string
+		format   string
+		encoding string
+	}{
+		// Each quote is escaped to two bytes.
+		{"escaped", strings.Repeat(`"`, 200*1024), FormatJSONPretty, BinaryEncodingReplace},
+		{"escaped multibyte", strings.Repeat("\u00e9\x00", 70*1024), FormatJSON, BinaryEncodingReplace},
+		{"base64", strings.Repeat("\xff ", 200*1024), FormatJSON, BinaryEncodingBase64},
+		{"logfmt", strings.Repeat("\n", 200*1024), FormatLogfmt, BinaryEncodingReplace},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			converter := NewEntryToEventConverter(dummyInstanceID, time.Now, WithMaxMessageSize(200*1024),
+				WithFormat(tc.format), WithBinaryEncoding(tc.encoding))
+			event := converter(&sdjournal.JournalEntry{Fields: map[string]string{"MESSAGE": tc.message}})[0]
+			assert.LessOrEqual(t, eventSize(event), maxCWLEventSize)
+			// Little room is left.
+			assert.Greater(t, eventSize(event), maxCWLEventSize-1024)
+			if tc.format == FormatLogfmt {
+				assert.Contains(t, *event.Message, fmt.Sprintf("truncated=true originalLength=%d", len(tc.message)))
+				return
+			}
+			var r Record
+			assert.NoError(t, json.Unmarshal([]byte(*event.Message), &r))
+			assert.True(t, r.Truncated)
+			assert.Equal(t, len(tc.message), r.OriginalLength)
+		})
+	}
+}
+
+// TestMessageSize tests that the size of the message in the record is what the record grows by with the message. A
+// binary message is compared with another one, since the record tells its encoding. logfmt quotes both or neither.
+func TestMessageSize(t *testing.T) {
+	messages := map[string]string{
+		"a b":            " ",
+		"\"<\u2028>&\"":  " ",
+		"\u00e9\t\x01\n": " ",
+		"\xff\xfe a":     "\xff ",
+	}
+	for _, format := range []string{FormatJSON, FormatJSONPretty, FormatShort, FormatLogfmt} {
+		for _, encoding := range []string{BinaryEncodingReplace, BinaryEncodingBase64, BinaryEncodingHex} {
+			o := converterOptions{format: format, binaryEncoding: encoding}
+			for message, other := range messages {
+				encoded, err := encodeEvent(Record{Message: message}, &o)
+				assert.NoError(t, err)
+				encodedOther, err := encodeEvent(Record{Message: other}, &o)
+				assert.NoError(t, err)
+				assert.Equal(t, len(encoded)-len(encodedOther), messageSize(message, &o)-messageSize(other, &o),
+					"%s %s %q", format, encoding, message)
+			}
+		}
+	}
+}
+
+func TestEntryToEventConverterWithTimestamp(t *testing.T) {
+	readTime := time.UnixMilli(int64(1722650790111))
+	now := func() time.Time {
+		return readTime
+	}
+	entry, _ := getExampleEntryAndEvent(dummyInstanceID, readTime, "cursor-0")
+	entry.RealtimeTimestamp = 1722650000222333
+	entry.Fields["_SOURCE_REALTIME_TIMESTAMP"] = "1722649000333444"
+
+	cases := []struct {
+		source   string
+		expected int64
+	}{
+		{TimestampRead, 1722650790111},
+		{TimestampRealtime, 1722650000222},
+		{TimestampSource, 1722649000333},
+	}
+	for _, tc := range cases {
+		t.Run(tc.source, func(t *testing.T) {
+			converter := NewEntryToEventConverter(dummyInstanceID, now, WithTimestamp(tc.source))
+			assert.Equal(t, tc.expected, *converter(entry)[0].Timestamp)
+		})
+	}
+
+	// Fall back to the realtime timestamp, then the read time.
+	delete(entry.Fields, "_SOURCE_REALTIME_TIMESTAMP")
+	converter := NewEntryToEventConverter(dummyInstanceID, now, WithTimestamp(TimestampSource))
+	assert.Equal(t, int64(1722650000222), *converter(entry)[0].Timestamp)
+	entry.RealtimeTimestamp = 0
+	assert.Equal(t, int64(1722650790111), *converter(entry)[0].Timestamp)
+}
+
+// TestBatchSortsBySpan tests sorting log events of a batch by timestamp, and starting a new batch when the batch would
+// span more than 24 hours.
+func TestBatchSortsBySpan(t *testing.T) {
+	now := time.Now
+	converter := NewEntryToEventConverter(dummyInstanceID, now, WithTimestamp(TimestampRealtime))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	entriesChan := make(chan *sdjournal.JournalEntry)
+	// Older events would be clamped to now.
+	base := time.UnixMilli(time.Now().Add(-48 * time.Hour).UnixMilli())
+	offsets := []time.Duration{time.Hour, 0, 2 * time.Hour, 25 * time.Hour, 24 * time.Hour}
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		for i, offset := range offsets {
+			entry, _ := getExampleEntryAndEvent(dummyInstanceID, base, fmt.Sprintf("cursor-%d", i))
+			entry.RealtimeTimestamp = uint64(base.Add(offset).UnixMicro()) //nolint:gosec
+			entriesChan <- entry
+		}
+	}()
+
+	batcher := NewBatcher(entriesChan, converter, WithMaxWait(time.Minute))
+	go batcher.Batch(ctx)
+
+	batch := <-batcher.Batches()
+	assert.Equal(t, "cursor-2", batch.Cursor)
+	var timestamps []int64
+	for _, e := range batch.Events {
+		timestamps = append(timestamps, *e.Timestamp)
+	}
+	assert.Equal(t, []int64{
+		base.UnixMilli(),
+		base.Add(time.Hour).UnixMilli(),
+		base.Add(2 * time.Hour).UnixMilli(),
+	}, timestamps)
+	assert.Equal(t, entryID("cursor-2"), batch.EntryID)
+
+	// Flush the rest.
+	<-sent
+	cancel()
+	batch = <-batcher.Batches()
+	assert.Equal(t, "cursor-4", batch.Cursor)
+	assert.Len(t, batch.Events, 2)
+	assert.Equal(t, base.Add(24*time.Hour).UnixMilli(), *batch.Events[0].Timestamp)
+	// The entry id is of the last log event after sorting, not of the last entry.
+	assert.Equal(t, entryID("cursor-3"), batch.EntryID)
+}
+
 // TestBatchOnMaxEvents tests batching entries into batch every maxEvents.
 func TestBatchOnMaxEvents(t *testing.T) {
 	timeUnixMilli := time.UnixMilli(int64(1722650790111))
@@ -56,6 +355,65 @@ func TestBatchOnMaxEvents(t *testing.T) {
 	assert.Equal(t, "cursor-3", batch.Cursor)
 }
 
+// TestBatchWhenEntriesEnd tests that the last batch is delivered and the batches channel is closed when the entries
+// channel is closed.
+func TestBatchWhenEntriesEnd(t *testing.T) {
+	timeUnixMilli := time.UnixMilli(int64(1722650790111))
+	now := func() time.Time {
+		return timeUnixMilli
+	}
+	converter := NewEntryToEventConverter(dummyInstanceID, now)
+
+	entriesChan := make(chan *sdjournal.JournalEntry)
+	go func() {
+		for i := 0; i < 3; i++ {
+			entry, _ := getExampleEntryAndEvent(dummyInstanceID, timeUnixMilli, fmt.Sprintf("cursor-%d", i))
+			entriesChan <- entry
+		}
+		close(entriesChan)
+	}()
+
+	batcher := NewBatcher(entriesChan, converter, WithMaxWait(time.Minute))
+	go batcher.Batch(context.Background())
+
+	batch := <-batcher.Batches()
+	assert.Equal(t, "cursor-2", batch.Cursor)
+	assert.Len(t, batch.Events, 3)
+	_, ok := <-batcher.Batches()
+	assert.False(t, ok)
+}
+
+// TestBatchOnMaxPayload tests batching entries by the size of messages in the format.
+func TestBatchOnMaxPayload(t *testing.T) {
+	timeUnixMilli := time.UnixMilli(int64(1722650790111))
+	now := func() time.Time {
+		return timeUnixMilli
+	}
+	// Each message is "sshd[1]: connection lost", 24 bytes, plus 26 bytes of overhead.
+	converter := NewEntryToEventConverter(dummyInstanceID, now, WithFormat(FormatShort))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	entriesChan := make(chan *sdjournal.JournalEntry)
+	go func() {
+		for i := 0; i < 10; i++ {
+			entry, _ := getExampleEntryAndEvent(dummyInstanceID, timeUnixMilli, fmt.Sprintf("cursor-%d", i))
+			entriesChan <- entry
+		}
+	}()
+
+	batcher := NewBatcher(entriesChan, converter, WithMaxPayload(200), WithMaxWait(time.Minute))
+	go batcher.Batch(ctx)
+
+	batch := <-batcher.Batches()
+	assert.Len(t, batch.Events, 4)
+	assert.Equal(t, "cursor-3", batch.Cursor)
+	// Short messages have no entry id, so the batch is found in CWL by the timestamp and message of its last log event.
+	assert.Empty(t, batch.EntryID)
+	batch = <-batcher.Batches()
+	assert.Equal(t, "cursor-7", batch.Cursor)
+}
+
 func TestBatchOnMaxWait(t *testing.T) {
 	timeUnixMilli := time.UnixMilli(int64(1722650790111))
 	now := func() time.Time {
@@ -114,6 +472,7 @@ func getExampleEntryAndEvent(instanceID string, timestamp time.Time, cursor stri
 {
     "instanceId": "%s",
     "realTimestamp": 1722650790111473,
+    "entryId": "%s",
     "pid": 1,
     "uid": 2,
     "gid": 3,
@@ -131,7 +490,7 @@ func getExampleEntryAndEvent(instanceID string, timestamp time.Time, cursor stri
         "pid": 1
     }
 }
-`, instanceID)
+`, instanceID, entryID(cursor))
 
 	event := cloudwatchlogs.InputLogEvent{
 		Message:   aws.String(message),
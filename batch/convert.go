@@ -1,42 +1,499 @@
 package batch
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"math"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/coreos/go-systemd/v22/sdjournal"
+
+	"snappydevtools.com/journald-to-cwl/journal"
+)
+
+// EntryToEventConverter convertes journal entry to log events. An entry is one log event, unless its message is split
+// into several log events, see WithSplitMessages.
+type EntryToEventConverter func(e *sdjournal.JournalEntry) []types.InputLogEvent
+
+// Encodings of messages that are not valid UTF-8, e.g. binary MESSAGE fields.
+const (
+	// BinaryEncodingReplace replaces invalid bytes with the Unicode replacement character, which is what JSON encoding
+	// does anyway.
+	BinaryEncodingReplace = "replace"
+
+	BinaryEncodingBase64 = "base64"
+
+	BinaryEncodingHex = "hex"
+)
+
+// Sources of log event timestamps.
+const (
+	// TimestampRead is the time the entry is read, which was the only source before sources were added.
+	TimestampRead = "read"
+
+	// TimestampRealtime is the time journald received the entry, __REALTIME_TIMESTAMP.
+	TimestampRealtime = "realtime"
+
+	// TimestampSource is the time the entry was logged at the source, _SOURCE_REALTIME_TIMESTAMP, if the entry has it,
+	// e.g. kernel messages or entries sent with sd_journal_send(3). Otherwise, it is TimestampRealtime.
+	TimestampSource = "source"
 )
 
-// EntryToEventConverter convertes journal entry to log event.
-type EntryToEventConverter func(e *sdjournal.JournalEntry) types.InputLogEvent
+// converterOptions are the optional settings of NewEntryToEventConverter.
+type converterOptions struct {
+	namespace string
+
+	origin string
+
+	binaryEncoding string
+
+	format string
+
+	// Journal fields to add to Record.Fields, or AllFields, and how to name them.
+	includeFields []string
+	fieldNames    string
+
+	// Journal fields to leave out of the record.
+	excludeFields []string
+
+	timestamp string
+
+	// Maximum bytes of the message, 0 if there is no limit.
+	maxMessageSize int
+
+	// Whether to split messages over maxMessageSize instead of truncating them.
+	splitMessages bool
+
+	// Redaction rules and the journal fields they apply to.
+	redactionRules []RedactionRule
+	redactFields   []string
+
+	// Built-in detectors to enable, and what to replace detected data with.
+	detectors       []string
+	detectionAction string
+	detectionKey    string
+
+	// Formats of messages to parse into the record under parsedKey.
+	messageFormats []string
+	parsedKey      string
+
+	// Parsers of messages of units and syslog identifiers, which are put under parsedKey as well.
+	parsers []Parser
+
+	// Whether to add authentication and privilege events to records.
+	authEvents bool
+}
+
+type ConverterOption func(*converterOptions)
+
+// WithNamespace tags records with the journal namespace the entries are read from.
+func WithNamespace(namespace string) ConverterOption {
+	return func(o *converterOptions) {
+		o.namespace = namespace
+	}
+}
+
+// WithOrigin tags records with the journal the entries are read from, e.g. "system", "user:1000" or
+// "container:<machine-id>".
+func WithOrigin(origin string) ConverterOption {
+	return func(o *converterOptions) {
+		o.origin = origin
+	}
+}
+
+// WithBinaryEncoding sets how to encode messages that are not valid UTF-8, one of BinaryEncodingReplace,
+// BinaryEncodingBase64 and BinaryEncodingHex. The default is BinaryEncodingReplace.
+func WithBinaryEncoding(encoding string) ConverterOption {
+	return func(o *converterOptions) {
+		o.binaryEncoding = encoding
+	}
+}
+
+// WithFormat sets the format of log event messages, one of FormatJSON, FormatJSONPretty, FormatShort and
+// FormatLogfmt. The default is FormatJSONPretty.
+func WithFormat(format string) ConverterOption {
+	return func(o *converterOptions) {
+		o.format = format
+	}
+}
+
+// WithIncludeFields adds the journal fields that are not in Record to Record.Fields. AllFields includes all of them.
+func WithIncludeFields(fields ...string) ConverterOption {
+	return func(o *converterOptions) {
+		o.includeFields = fields
+	}
+}
+
+// WithExcludeFields leaves the journal fields out of the record, including the fields that are in Record.
+func WithExcludeFields(fields ...string) ConverterOption {
+	return func(o *converterOptions) {
+		o.excludeFields = fields
+	}
+}
+
+// WithFieldNames sets how to name journal fields in Record.Fields, FieldNamesNative or FieldNamesCamel. The default is
+// FieldNamesNative.
+func WithFieldNames(fieldNames string) ConverterOption {
+	return func(o *converterOptions) {
+		o.fieldNames = fieldNames
+	}
+}
+
+// WithTimestamp sets the source of log event timestamps, one of TimestampRead, TimestampRealtime and TimestampSource.
+// The default is TimestampRead.
+func WithTimestamp(source string) ConverterOption {
+	return func(o *converterOptions) {
+		o.timestamp = source
+	}
+}
+
+// WithMaxMessageSize truncates messages longer than n bytes, at a UTF-8 boundary, and marks them as truncated with
+// their original length. Other fields are kept, so the log event is still a valid record.
+func WithMaxMessageSize(n int) ConverterOption {
+	return func(o *converterOptions) {
+		o.maxMessageSize = n
+	}
+}
+
+// WithSplitMessages splits messages longer than the maximum message size into several log events linked by
+// RecordSplit, instead of truncating them.
+func WithSplitMessages() ConverterOption {
+	return func(o *converterOptions) {
+		o.splitMessages = true
+	}
+}
+
+// WithRedaction applies the redaction rules to the journal fields, in order, before the record is made. The number of
+// replaced matches is in Record.Redactions.
+func WithRedaction(fields []string, rules ...RedactionRule) ConverterOption {
+	return func(o *converterOptions) {
+		o.redactFields = fields
+		o.redactionRules = rules
+	}
+}
+
+// WithDetectors enables the named built-in detectors, e.g. DetectorEmail, or all of them with AllDetectors. Data they
+// find in the fields copied to the record is replaced according to the action, DetectionMask or DetectionHash with the
+// key. The names of the detectors that found data are in Record.Detections.
+func WithDetectors(action string, key string, names ...string) ConverterOption {
+	return func(o *converterOptions) {
+		o.detectionAction = action
+		o.detectionKey = key
+		o.detectors = names
+	}
+}
+
+// WithMessageParsing parses messages in the formats, MessageFormatJSON or MessageFormatLogfmt, tried in order, and
+// puts the parsed object under the key of the record instead of the message. Messages that are in none of the formats,
+// or that are truncated or split, stay as they are. The short format has the message only, so it is not parsed.
+func WithMessageParsing(key string, formats ...string) ConverterOption {
+	return func(o *converterOptions) {
+		o.parsedKey = key
+		o.messageFormats = formats
+	}
+}
+
+// WithParsers parses the messages of entries that a parser is bound to with the first such parser, and puts the
+// extracted fields under the key of the record, next to the message. Messages that the parser does not match, or that
+// are truncated or split, are marked with Record.Unparsed. Other entries are left to WithMessageParsing.
+func WithParsers(key string, parsers ...Parser) ConverterOption {
+	return func(o *converterOptions) {
+		o.parsedKey = key
+		o.parsers = parsers
+	}
+}
+
+// WithAuthEvents recognizes the login, session, sudo and su messages of sshd, sudo, su and pam_unix, and adds the
+// normalized event to Record.Auth.
+func WithAuthEvents() ConverterOption {
+	return func(o *converterOptions) {
+		o.authEvents = true
+	}
+}
 
 // NewEntryToEventConverter returns a converter that adds instanceID to the entry, and uses the given timestampFn for
-// the CWL log event timestamp.
-func NewEntryToEventConverter(instanceID string, timestampFn func() time.Time) EntryToEventConverter {
-	return func(e *sdjournal.JournalEntry) types.InputLogEvent {
+// the CWL log event timestamp, unless WithTimestamp selects a timestamp of the entry.
+func NewEntryToEventConverter(
+	instanceID string,
+	timestampFn func() time.Time,
+	opts ...ConverterOption,
+) EntryToEventConverter {
+	o := converterOptions{
+		binaryEncoding: BinaryEncodingReplace,
+		format:         FormatJSONPretty,
+		fieldNames:     FieldNamesNative,
+		timestamp:      TimestampRead,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	var detection *detection
+	if len(o.detectors) > 0 {
+		detection = newDetection(o.detectors, o.detectionAction, o.detectionKey, o.includeFields)
+	}
+	return func(e *sdjournal.JournalEntry) []types.InputLogEvent {
+		if len(o.excludeFields) > 0 {
+			filtered := *e
+			filtered.Fields = withoutFields(e.Fields, o.excludeFields)
+			e = &filtered
+		}
+		redactions := 0
+		if len(o.redactionRules) > 0 {
+			redacted := *e
+			redacted.Fields, redactions = redact(e.Fields, o.redactFields, o.redactionRules)
+			e = &redacted
+		}
+		var detections []string
+		if detection != nil {
+			detected := *e
+			var n int
+			detected.Fields, detections, n = detection.detect(e.Fields)
+			redactions += n
+			e = &detected
+		}
 		r := recordFromJournalEntryFields(e)
+		r.Redactions = redactions
+		r.Detections = detections
+		r.Fields = extraFields(e.Fields, o.includeFields, o.fieldNames)
 		r.InstanceID = instanceID
+		r.Namespace = o.namespace
+		r.Origin = o.origin
+		if o.authEvents {
+			r.Auth = authEvent(r)
+		}
+		// The assembler checks the data threshold per entry, before entries are merged, see journal.WithDataThreshold.
+		r.Truncated = e.Fields[journal.TruncatedField] == "true"
+		// The audit fields repeat the message, so they take room of the message, and they are of the whole message.
+		if r.Truncated || o.maxMessageSize > 0 && len(r.Message)+auditFieldsSize(r) > o.maxMessageSize {
+			r.dropAuditFields()
+		}
+		// A message that fits in the maximum message size is split as well if its encoded record does not fit in a log
+		// event. A record that does not fit even with one character of the message, e.g. because of big fields, is
+		// not split but replaced by a placeholder, see fitRecord.
+		id := entryID(journal.EntryCursor(e))
+		split := o.maxMessageSize > 0 && o.splitMessages &&
+			(len(r.Message) > o.maxMessageSize || !eventFits(*r, &o)) && splittable(*r, id, &o)
+		if o.maxMessageSize > 0 && !o.splitMessages && len(r.Message) > o.maxMessageSize {
+			r.OriginalLength = len(r.Message)
+			r.Message = truncateUTF8(r.Message, o.maxMessageSize)
+			r.Truncated = true
+		}
 
-		event := types.InputLogEvent{
-			// Use the timestamp of reading the entry to keep the existing behavior. The timestamp of the entry can be
-			// found in realTimestamp of the log.
-			Timestamp: aws.Int64(timestampFn().UnixMilli()),
+		// The record is parsed before it is split, so every part is marked as unparsed and sized with the mark.
+		if o.format != FormatShort {
+			parseRecord(r, e.Fields, !split, &o)
 		}
-		// Indent to keep the existing behavior.
-		jsonDataBytes, err := json.MarshalIndent(r, "", "  ")
-		if err != nil {
-			event.Message = aws.String(fmt.Sprintf("cannot marshal record, %s", err))
-			return event
+		records := []*Record{r}
+		if split {
+			r.dropAuditFields()
+			records = splitRecord(r, o.maxMessageSize, id, &o)
 		}
-		event.Message = aws.String(string(jsonDataBytes))
-		return event
+
+		timestamp := entryTimestamp(e, o.timestamp, timestampFn).UnixMilli()
+		events := make([]types.InputLogEvent, 0, len(records))
+		for _, r := range records {
+			event := types.InputLogEvent{
+				Timestamp: aws.Int64(timestamp),
+			}
+			message, err := fitRecord(r, &o)
+			if err != nil {
+				message = fmt.Sprintf("cannot marshal record, %s", err)
+			}
+			event.Message = aws.String(message)
+			events = append(events, event)
+		}
+		return events
 	}
 }
 
+// fitRecord encodes the record into the message of a log event. The encoded record is longer than the message, which is
+// escaped, indented or binary encoded, and the record has other fields. So if the log event would be over
+// maxCWLEventSize, the parsed message is left out, then the audit fields, and then the message is cut to the longest
+// that fits, if any. If the record does not fit even without the message, e.g. because of big fields, it is replaced
+// by a placeholder, see placeholderRecord, so the entry is not lost without a trace.
+func fitRecord(r *Record, o *converterOptions) (string, error) {
+	message, err := encodeEvent(*r, o)
+	size := len(message)
+	if err == nil && len(message) > maxEventMessageSize && r.parsed != nil {
+		r.unparse()
+		message, err = encodeEvent(*r, o)
+	}
+	if err == nil && len(message) > maxEventMessageSize && auditFieldsSize(r) > 0 {
+		r.dropAuditFields()
+		message, err = encodeEvent(*r, o)
+	}
+	if err != nil || len(message) <= maxEventMessageSize {
+		return message, err
+	}
+	if r.Message != "" {
+		if r.OriginalLength == 0 {
+			r.OriginalLength = len(r.Message)
+		}
+		r.Truncated = true
+		r.Message, message, err = fittingPrefix(*r, r.Message, o)
+		if err != nil || len(message) <= maxEventMessageSize {
+			return message, err
+		}
+	}
+	return encodeEvent(placeholderRecord(r, size), o)
+}
+
+// placeholderRecord returns a record with only the fields of r that tell the entry, marked as truncated, with the size
+// of the encoded record that does not fit in a log event in OriginalSize.
+func placeholderRecord(r *Record, size int) Record {
+	return Record{
+		InstanceID:        r.InstanceID,
+		Namespace:         r.Namespace,
+		Origin:            r.Origin,
+		RealtimeTimestamp: r.RealtimeTimestamp,
+		EntryID:           r.EntryID,
+		PID:               r.PID,
+		UID:               r.UID,
+		GID:               r.GID,
+		SystemdUnit:       r.SystemdUnit,
+		BootID:            r.BootID,
+		MachineID:         r.MachineID,
+		Priority:          r.Priority,
+		Truncated:         true,
+		OriginalLength:    r.OriginalLength,
+		OriginalSize:      size,
+		Split:             r.Split,
+	}
+}
+
+// fittingPrefix returns the longest prefix of the message, cut at a UTF-8 boundary, with which the encoded record fits
+// in a log event, or "" if there is none, and the record encoded with the prefix. The rest of the record is the same
+// whatever the prefix, so the size of the record with a prefix is estimated from the size of the prefix in the
+// record, see messageSize. The record is encoded once more to check the estimate, and the prefix is only searched for
+// by encoding the record if the estimate is off, e.g. because a prefix of a binary message is valid UTF-8.
+func fittingPrefix(r Record, message string, o *converterOptions) (string, string, error) {
+	r.Message = message
+	encoded, err := encodeEvent(r, o)
+	if err != nil || len(encoded) <= maxEventMessageSize {
+		return message, encoded, err
+	}
+	n := prefixLen(message, maxEventMessageSize-len(encoded)+messageSize(message, o), o)
+	r.Message = message[:n]
+	if encoded, err = encodeEvent(r, o); err != nil || len(encoded) <= maxEventMessageSize {
+		return r.Message, encoded, err
+	}
+	// The encoded record grows with the message, so the longest message that fits is searched for.
+	n = sort.Search(n, func(n int) bool {
+		r.Message = truncateUTF8(message, n)
+		return !eventFits(r, o)
+	})
+	r.Message = truncateUTF8(message, max(0, n-1))
+	encoded, err = encodeEvent(r, o)
+	return r.Message, encoded, err
+}
+
+// prefixLen returns the length of the longest prefix of the message, cut at a UTF-8 boundary, whose size in the
+// encoded record is at most size, see messageSize.
+func prefixLen(message string, size int, o *converterOptions) int {
+	if !utf8.ValidString(message) {
+		// The binary encoding of a prefix is not a prefix of the encoding.
+		n := sort.Search(len(message), func(n int) bool {
+			return messageSize(truncateUTF8(message, n), o) > size
+		})
+		return len(truncateUTF8(message, max(0, n-1)))
+	}
+	if o.format != FormatShort {
+		size -= len(`""`)
+	}
+	n, _ := escapedPrefix(message, size, o.format)
+	return n
+}
+
+// messageSize returns the size of the message in the record encoded in the format, with the quotes, after encoding the
+// message if it is not valid UTF-8. It is 2 bytes more than the size in logfmt if the message is not quoted.
+func messageSize(message string, o *converterOptions) int {
+	if !utf8.ValidString(message) {
+		message = encodeBinary(message, o.binaryEncoding)
+	}
+	_, size := escapedPrefix(message, math.MaxInt, o.format)
+	if o.format != FormatShort {
+		size += len(`""`)
+	}
+	return size
+}
+
+// escapedPrefix returns the length of the longest prefix of the valid UTF-8 message whose characters take at most size
+// bytes once escaped in the format, and the size of the escaped prefix. A character is escaped the same wherever it is
+// in a string, so the escaped size of each character is taken from the encoder once.
+func escapedPrefix(message string, size int, format string) (int, int) {
+	sizes := make(map[rune]int)
+	total := 0
+	for i, c := range message {
+		s, ok := sizes[c]
+		if !ok {
+			s = escapedSize(c, format)
+			sizes[c] = s
+		}
+		if total+s > size {
+			return i, total
+		}
+		total += s
+	}
+	return len(message), total
+}
+
+// escapedSize returns the size of the character in a string encoded in the format, without the quotes.
+func escapedSize(c rune, format string) int {
+	s := string(c)
+	switch format {
+	case FormatShort:
+		return len(s)
+	case FormatLogfmt:
+		return len(strconv.Quote(s)) - len(`""`)
+	default:
+		b, _ := json.Marshal(s)
+		return len(b) - len(`""`)
+	}
+}
+
+// eventFits tells whether the encoded record fits in a log event.
+func eventFits(r Record, o *converterOptions) bool {
+	message, err := encodeEvent(r, o)
+	return err == nil && len(message) <= maxEventMessageSize
+}
+
+// encodeEvent encodes the record in the format, after encoding its message if it is not valid UTF-8. The record is a
+// copy, so the message is encoded every time the record is.
+func encodeEvent(r Record, o *converterOptions) (string, error) {
+	if !utf8.ValidString(r.Message) {
+		r.Message = encodeBinary(r.Message, o.binaryEncoding)
+		r.MessageEncoding = o.binaryEncoding
+	}
+	return encodeRecord(&r, o.format)
+}
+
+// entryTimestamp returns the timestamp of the entry from the source. It falls back to timestampFn if the entry has no
+// timestamp, e.g. an export without __REALTIME_TIMESTAMP.
+func entryTimestamp(e *sdjournal.JournalEntry, source string, timestampFn func() time.Time) time.Time {
+	usec := e.RealtimeTimestamp
+	switch source {
+	case TimestampRead:
+		return timestampFn()
+	case TimestampSource:
+		if v, err := strconv.ParseUint(e.Fields["_SOURCE_REALTIME_TIMESTAMP"], 10, 64); err == nil && v > 0 {
+			usec = v
+		}
+	}
+	if usec == 0 {
+		return timestampFn()
+	}
+	return time.UnixMicro(int64(usec)) //nolint:gosec
+}
+
 // priorityMap maps the integer priority level to human readable level. The map is the same as log levels from
 // `man` journalctl`.
 var priorityMap = map[string]string{
@@ -52,24 +509,60 @@ var priorityMap = map[string]string{
 
 // Record corresponds to a CWL event. It contains instance-id and fields from journal entry.
 // For common fields, refer https://www.freedesktop.org/software/systemd/man/latest/systemd.journal-fields.html.
+// EntryID is derived from the cursor of the entry, so the log event of an entry can be told from the log event of
+// another entry with the same message, e.g. when checking whether a batch is in CWL, see cwl.InFlight. MessageEncoding
+// is set when the message is not valid UTF-8, e.g. binary, and tells how it is encoded. Truncated is set when the
+// message may be cut by the journal data threshold, or is cut by the maximum message size, in which case OriginalLength
+// is the length of the message in bytes before it is cut. OriginalSize is set when the record does not fit in a log
+// event even without the message, and is the size of the encoded record, whose other fields are left out. Split is set
+// when the message is split instead, and OriginalLength is the length of the whole message. Redactions is the number of
+// matches replaced by redaction rules and detectors, and Detections are the names of the detectors that found data.
+// MessageFormat is set when the message is parsed, see WithMessageParsing, in which case the message is left out.
 type Record struct {
-	InstanceID        string       `json:"instanceId,omitempty"`
-	RealtimeTimestamp uint64       `json:"realTimestamp,omitempty"`
-	PID               int          `json:"pid"`
-	UID               int          `json:"uid"`
-	GID               int          `json:"gid"`
-	Command           string       `json:"cmdName,omitempty"`
-	Executable        string       `json:"exe,omitempty"`
-	SystemdUnit       string       `json:"systemdUnit,omitempty"`
-	BootID            string       `json:"bootId,omitempty"`
-	MachineID         string       `json:"machineId,omitempty"`
-	Hostname          string       `json:"hostname,omitempty"`
-	Transport         string       `json:"transport,omitempty"`
-	Priority          string       `json:"priority,omitempty"`
-	Message           string       `json:"message,omitempty"`
-	MesageID          string       `json:"messageId,omitempty"`
-	ErrNo             int          `json:"errNo,omitempty"`
-	Syslog            RecordSyslog `json:"syslog,omitempty"`
+	InstanceID        string           `json:"instanceId,omitempty"`
+	Namespace         string           `json:"namespace,omitempty"`
+	Origin            string           `json:"origin,omitempty"`
+	RealtimeTimestamp uint64           `json:"realTimestamp,omitempty"`
+	EntryID           string           `json:"entryId,omitempty"`
+	PID               int              `json:"pid"`
+	UID               int              `json:"uid"`
+	GID               int              `json:"gid"`
+	Command           string           `json:"cmdName,omitempty"`
+	Executable        string           `json:"exe,omitempty"`
+	SystemdUnit       string           `json:"systemdUnit,omitempty"`
+	BootID            string           `json:"bootId,omitempty"`
+	MachineID         string           `json:"machineId,omitempty"`
+	Hostname          string           `json:"hostname,omitempty"`
+	Transport         string           `json:"transport,omitempty"`
+	Priority          string           `json:"priority,omitempty"`
+	Message           string           `json:"message,omitempty"`
+	MessageEncoding   string           `json:"messageEncoding,omitempty"`
+	MessageFormat     string           `json:"messageFormat,omitempty"`
+	Unparsed          string           `json:"unparsed,omitempty"`
+	Truncated         bool             `json:"truncated,omitempty"`
+	Redactions        int              `json:"redactions,omitempty"`
+	Detections        []string         `json:"detections,omitempty"`
+	OriginalLength    int              `json:"originalLength,omitempty"`
+	OriginalSize      int              `json:"originalSize,omitempty"`
+	MesageID          string           `json:"messageId,omitempty"`
+	ErrNo             int              `json:"errNo,omitempty"`
+	Syslog            RecordSyslog     `json:"syslog,omitempty"`
+	Container         *RecordContainer `json:"container,omitempty"`
+	Auth              *RecordAuth      `json:"auth,omitempty"`
+	Kernel            *RecordKernel    `json:"kernel,omitempty"`
+	Audit             *RecordAudit     `json:"audit,omitempty"`
+	Gap               *RecordGap       `json:"gap,omitempty"`
+	Split             *RecordSplit     `json:"split,omitempty"`
+
+	// Fields are the selected journal fields that are not in Record, e.g. fields sent by applications with
+	// sd_journal_send(3).
+	Fields map[string]string `json:"fields,omitempty"`
+
+	// parsed is the message parsed into a JSON object, which is encoded under parsedKey, see MarshalJSON. message is
+	// the message that parsed replaces, if it is not kept in Message.
+	parsed    json.RawMessage
+	parsedKey string
+	message   string
 }
 
 type RecordSyslog struct {
@@ -78,10 +571,36 @@ type RecordSyslog struct {
 	PID        int    `json:"pid,omitempty"`
 }
 
+// RecordContainer describes the container of entries written by Docker's journald log driver.
+type RecordContainer struct {
+	Name  string `json:"name,omitempty"`
+	ID    string `json:"id,omitempty"`
+	Tag   string `json:"tag,omitempty"`
+	Image string `json:"image,omitempty"`
+}
+
+// RecordGap describes journal entries missing before this record, e.g. vacuumed while journald-to-cwl was not running.
+// Timestamps are realtime timestamps in microseconds. EstimatedCount is omitted if the number is unknown.
+type RecordGap struct {
+	FromRealtimeTimestamp uint64 `json:"fromRealTimestamp"`
+	ToRealtimeTimestamp   uint64 `json:"toRealTimestamp"`
+	EstimatedCount        uint64 `json:"estimatedCount,omitempty"`
+}
+
+// entryID returns the id of the entry at the cursor, or "" if the entry has no cursor.
+func entryID(cursor string) string {
+	if cursor == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(cursor))
+	return hex.EncodeToString(sum[:8])
+}
+
 // recordFromJournalEntryFields fills a Record with fields from a journal entry.
 func recordFromJournalEntryFields(e *sdjournal.JournalEntry) *Record {
 	var r Record
 	r.RealtimeTimestamp = e.RealtimeTimestamp
+	r.EntryID = entryID(journal.EntryCursor(e))
 	f := e.Fields
 	if pid, err := strconv.Atoi(f["_PID"]); err == nil {
 		r.PID = pid
@@ -113,5 +632,36 @@ func recordFromJournalEntryFields(e *sdjournal.JournalEntry) *Record {
 		r.Syslog.PID = pid
 	}
 	r.Syslog.Identifier = f["SYSLOG_IDENTIFIER"]
+
+	container := RecordContainer{
+		Name:  f["CONTAINER_NAME"],
+		ID:    f["CONTAINER_ID"],
+		Tag:   f["CONTAINER_TAG"],
+		Image: f["IMAGE_NAME"],
+	}
+	if container != (RecordContainer{}) {
+		r.Container = &container
+	}
+	r.Kernel = kernelRecord(f)
+	r.Audit = auditRecord(f)
+
+	if from, ok := f[journal.GapFromField]; ok {
+		r.Gap = &RecordGap{}
+		r.Gap.FromRealtimeTimestamp, _ = strconv.ParseUint(from, 10, 64)
+		r.Gap.ToRealtimeTimestamp, _ = strconv.ParseUint(f[journal.GapToField], 10, 64)
+		r.Gap.EstimatedCount, _ = strconv.ParseUint(f[journal.GapCountField], 10, 64)
+	}
 	return &r
 }
+
+// encodeBinary encodes a message that is not valid UTF-8.
+func encodeBinary(message string, encoding string) string {
+	switch encoding {
+	case BinaryEncodingBase64:
+		return base64.StdEncoding.EncodeToString([]byte(message))
+	case BinaryEncodingHex:
+		return hex.EncodeToString([]byte(message))
+	default:
+		return strings.ToValidUTF8(message, "\uFFFD")
+	}
+}
@@ -0,0 +1,229 @@
+package batch
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"slices"
+	"sort"
+)
+
+// Built-in detectors of secrets and personal data.
+const (
+	DetectorAWSAccessKey = "aws_access_key"
+	DetectorPrivateKey   = "private_key"
+	DetectorJWT          = "jwt"
+	DetectorBearerToken  = "bearer_token"
+	DetectorURLPassword  = "url_password"
+	DetectorEmail        = "email"
+	DetectorCreditCard   = "credit_card"
+
+	// AllDetectors in the detector names enables all detectors.
+	AllDetectors = "*"
+)
+
+// What to replace detected data with.
+const (
+	// DetectionMask replaces the data with "[<detector>]", e.g. "[email]".
+	DetectionMask = "mask"
+
+	// DetectionHash replaces the data with "[<detector>:<hash>]", where the hash is a keyed hash of the data, so the
+	// same data can be correlated across log events without revealing it.
+	DetectionHash = "hash"
+)
+
+// detector finds data by pattern. If the pattern has a submatch named "secret", only the submatch is replaced, e.g.
+// the password of a URL. If valid is set, matches that are not valid are ignored.
+type detector struct {
+	name    string
+	pattern *regexp.Regexp
+	valid   func(string) bool
+}
+
+// DetectorNames returns the names of the built-in detectors, which are accepted by WithDetectors besides AllDetectors.
+func DetectorNames() []string {
+	names := make([]string, 0, len(detectors))
+	for _, det := range detectors {
+		names = append(names, det.name)
+	}
+	return names
+}
+
+// detectors are in the order they are applied. Detectors of data that contains other data go first, e.g. a password in
+// a URL looks like an email.
+var detectors = []detector{
+	{
+		name:    DetectorPrivateKey,
+		pattern: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----(?s:.*?)(?:-----END [A-Z ]*PRIVATE KEY-----|$)`),
+	},
+	{
+		name:    DetectorAWSAccessKey,
+		pattern: regexp.MustCompile(`\b(?:AKIA|ASIA|ABIA|ACCA|AGPA|AIDA|AIPA|ANPA|ANVA|AROA|APKA)[A-Z2-7]{16}\b`),
+	},
+	{
+		name:    DetectorJWT,
+		pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`),
+	},
+	{
+		name:    DetectorBearerToken,
+		pattern: regexp.MustCompile(`(?i)\bbearer\s+(?P<secret>[A-Za-z0-9._~+/-]+=*)`),
+	},
+	{
+		name:    DetectorURLPassword,
+		pattern: regexp.MustCompile(`\b[A-Za-z][A-Za-z0-9+.-]*://[^:/@\s]+:(?P<secret>[^@/\s]+)@`),
+	},
+	{
+		name:    DetectorEmail,
+		pattern: regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`),
+	},
+	{
+		name:    DetectorCreditCard,
+		pattern: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+		valid:   luhn,
+	},
+}
+
+// metadataFields are trusted journal fields that journald sets to ids, numbers and timestamps, so they are not
+// scanned, e.g. a 16 digit timestamp may pass as a credit card number.
+var metadataFields = map[string]bool{
+	"_SOURCE_REALTIME_TIMESTAMP":  true,
+	"_SOURCE_MONOTONIC_TIMESTAMP": true,
+	"_STREAM_ID":                  true,
+	"_SYSTEMD_INVOCATION_ID":      true,
+	"INVOCATION_ID":               true,
+	"_AUDIT_SESSION":              true,
+	"_AUDIT_LOGINUID":             true,
+	"_CAP_EFFECTIVE":              true,
+	"_SYSTEMD_OWNER_UID":          true,
+	"_SELINUX_CONTEXT":            true,
+}
+
+// detection replaces data found by the enabled detectors.
+type detection struct {
+	detectors []detector
+
+	// key of the hash if data is replaced with its hash, nil if data is masked.
+	key []byte
+
+	// includeFields are the fields added to Record.Fields, which are scanned as well.
+	includeFields []string
+}
+
+// newDetection returns the detection by the named detectors, or all detectors if names has AllDetectors.
+func newDetection(names []string, action string, key string, includeFields []string) *detection {
+	d := detection{includeFields: includeFields}
+	for _, det := range detectors {
+		if slices.Contains(names, AllDetectors) || slices.Contains(names, det.name) {
+			d.detectors = append(d.detectors, det)
+		}
+	}
+	if action == DetectionHash {
+		d.key = []byte(key)
+	}
+	return &d
+}
+
+// scans tells whether the field is copied to the record, as a text field of Record or in Record.Fields.
+func (d *detection) scans(field string) bool {
+	if f, ok := recordFields[field]; ok {
+		return f.text
+	}
+	if metadataFields[field] {
+		return false
+	}
+	return slices.Contains(d.includeFields, AllFields) || slices.Contains(d.includeFields, field)
+}
+
+// detect replaces detected data in the fields that are copied to the record. It returns the fields, the sorted names
+// of the detectors that found data and the number of replacements. The fields are not modified, they are copied if
+// anything is replaced.
+func (d *detection) detect(fields map[string]string) (map[string]string, []string, int) {
+	found := make(map[string]bool)
+	count := 0
+	replaced := fields
+	for k, v := range fields {
+		if !d.scans(k) {
+			continue
+		}
+		n := 0
+		for _, det := range d.detectors {
+			var m int
+			if v, m = d.replace(det, v); m > 0 {
+				found[det.name] = true
+				n += m
+			}
+		}
+		if n == 0 {
+			continue
+		}
+		if count == 0 {
+			replaced = copyFields(fields)
+		}
+		replaced[k] = v
+		count += n
+	}
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return replaced, names, count
+}
+
+// replace replaces the valid matches of the detector in s, and returns the number of replacements.
+func (d *detection) replace(det detector, s string) (string, int) {
+	secret := det.pattern.SubexpIndex("secret")
+	matches := det.pattern.FindAllStringSubmatchIndex(s, -1)
+	var b []byte
+	last, count := 0, 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		if secret > 0 {
+			start, end = m[2*secret], m[2*secret+1]
+		}
+		if det.valid != nil && !det.valid(s[start:end]) {
+			continue
+		}
+		b = append(b, s[last:start]...)
+		b = append(b, d.replacement(det.name, s[start:end])...)
+		last = end
+		count++
+	}
+	if count == 0 {
+		return s, 0
+	}
+	b = append(b, s[last:]...)
+	return string(b), count
+}
+
+// replacement returns the mask or the keyed hash of the data.
+func (d *detection) replacement(name, data string) string {
+	if d.key == nil {
+		return "[" + name + "]"
+	}
+	mac := hmac.New(sha256.New, d.key)
+	mac.Write([]byte(data))
+	return "[" + name + ":" + hex.EncodeToString(mac.Sum(nil)[:8]) + "]"
+}
+
+// luhn tells whether the digits in s, ignoring spaces and dashes, pass the Luhn checksum of payment card numbers.
+func luhn(s string) bool {
+	sum, double := 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		n := int(c - '0')
+		if double {
+			n *= 2
+			if n > 9 {
+				n -= 9
+			}
+		}
+		sum += n
+		double = !double
+	}
+	return sum%10 == 0
+}
@@ -0,0 +1,127 @@
+package batch
+
+import (
+	"slices"
+	"strings"
+
+	"snappydevtools.com/journald-to-cwl/journal"
+)
+
+// AllFields in the included fields includes all journal fields.
+const AllFields = "*"
+
+// Names of journal fields in Record.Fields.
+const (
+	// FieldNamesNative keeps journal field names, e.g. "_SYSTEMD_USER_UNIT".
+	FieldNamesNative = "native"
+
+	// FieldNamesCamel converts journal field names to camelCase without leading underscores, e.g. "systemdUserUnit".
+	FieldNamesCamel = "camel"
+)
+
+// recordField is a journal field that recordFromJournalEntryFields copies to Record.
+type recordField struct {
+	// text tells whether the field is free text, e.g. a name or a message, rather than a number, an id or a fixed
+	// value. Detectors scan text fields, since they can have secrets or personal data.
+	text bool
+}
+
+// recordFields are the journal fields that recordFromJournalEntryFields copies to Record, so they are not repeated in
+// Record.Fields.
+var recordFields = map[string]recordField{
+	"_PID":                   {},
+	"_UID":                   {},
+	"_GID":                   {},
+	"ERRNO":                  {},
+	"_COMM":                  {text: true},
+	"_EXE":                   {text: true},
+	"_SYSTEMD_UNIT":          {text: true},
+	"_BOOT_ID":               {},
+	"_MACHINE_ID":            {},
+	"_HOSTNAME":              {text: true},
+	"_TRANSPORT":             {},
+	"PRIORITY":               {},
+	"MESSAGE":                {text: true},
+	"MESSAGE_ID":             {},
+	"SYSLOG_FACILITY":        {},
+	"SYSLOG_PID":             {},
+	"SYSLOG_IDENTIFIER":      {text: true},
+	"CONTAINER_NAME":         {text: true},
+	"CONTAINER_ID":           {},
+	"CONTAINER_TAG":          {text: true},
+	"IMAGE_NAME":             {text: true},
+	"_KERNEL_DEVICE":         {text: true},
+	"_KERNEL_SUBSYSTEM":      {text: true},
+	"_UDEV_SYSNAME":          {text: true},
+	"_UDEV_DEVNODE":          {text: true},
+	"_AUDIT_TYPE":            {},
+	"_AUDIT_TYPE_NAME":       {text: true},
+	"_AUDIT_ID":              {},
+	journal.EntryCursorField: {},
+	journal.TruncatedField:   {},
+	journal.GapFromField:     {},
+	journal.GapToField:       {},
+	journal.GapCountField:    {},
+}
+
+// withoutFields returns the fields without the excluded ones. The fields are not modified.
+func withoutFields(fields map[string]string, exclude []string) map[string]string {
+	filtered := make(map[string]string, len(fields))
+	for k, v := range fields {
+		if !slices.Contains(exclude, k) {
+			filtered[k] = v
+		}
+	}
+	return filtered
+}
+
+// extraFields returns the included fields that are not copied to Record, named by fieldNames, or nil if there are
+// none. If fields have the same camelCase name, e.g. FOO_BAR and FOO__BAR, a trusted field, which starts with an
+// underscore, is kept, or else the first field in sorted order, so the result does not depend on the map order.
+func extraFields(fields map[string]string, include []string, fieldNames string) map[string]string {
+	if len(include) == 0 {
+		return nil
+	}
+	all := slices.Contains(include, AllFields)
+	var keys []string
+	for k := range fields {
+		if _, ok := recordFields[k]; ok || !all && !slices.Contains(include, k) {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	slices.Sort(keys)
+	extra := make(map[string]string, len(keys))
+	// The fields that the camelCase names are taken from.
+	named := make(map[string]string)
+	for _, k := range keys {
+		name := k
+		if fieldNames == FieldNamesCamel {
+			name = camelCase(k)
+			if prev, ok := named[name]; ok && (strings.HasPrefix(prev, "_") || !strings.HasPrefix(k, "_")) {
+				continue
+			}
+			named[name] = k
+		}
+		extra[name] = fields[k]
+	}
+	return extra
+}
+
+// camelCase converts a journal field name, e.g. "_SYSTEMD_USER_UNIT", to camelCase, e.g. "systemdUserUnit".
+func camelCase(field string) string {
+	var sb strings.Builder
+	for _, word := range strings.Split(strings.ToLower(field), "_") {
+		if word == "" {
+			continue
+		}
+		if sb.Len() > 0 {
+			word = strings.ToUpper(word[:1]) + word[1:]
+		}
+		sb.WriteString(word)
+	}
+	return sb.String()
+}
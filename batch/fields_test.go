@@ -0,0 +1,103 @@
+package batch
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEntryToEventConverterWithFields(t *testing.T) {
+	timeUnixMilli := time.UnixMilli(int64(1722650790111))
+	now := func() time.Time {
+		return timeUnixMilli
+	}
+	entry, _ := getExampleEntryAndEvent(dummyInstanceID, timeUnixMilli, "cursor-0")
+	entry.Fields["REQUEST_ID"] = "42"
+	entry.Fields["_SYSTEMD_USER_UNIT"] = "app.service"
+
+	cases := []struct {
+		name     string
+		opts     []ConverterOption
+		expected map[string]string
+	}{
+		{
+			name: "default",
+		},
+		{
+			name:     "include",
+			opts:     []ConverterOption{WithIncludeFields("REQUEST_ID", "MESSAGE", "NON_EXIST")},
+			expected: map[string]string{"REQUEST_ID": "42"},
+		},
+		{
+			name: "all",
+			opts: []ConverterOption{WithIncludeFields(AllFields), WithExcludeFields("OTHER_KEY")},
+			expected: map[string]string{
+				"REQUEST_ID":         "42",
+				"_SYSTEMD_USER_UNIT": "app.service",
+				"_ERRNO":             "1",
+			},
+		},
+		{
+			name: "camel",
+			opts: []ConverterOption{WithIncludeFields(AllFields), WithFieldNames(FieldNamesCamel)},
+			expected: map[string]string{
+				"requestId":       "42",
+				"systemdUserUnit": "app.service",
+				"errno":           "1",
+				"otherKey":        "OTHTER_VALUE",
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			converter := NewEntryToEventConverter(dummyInstanceID, now, tc.opts...)
+			event := converter(entry)[0]
+			var r Record
+			assert.NoError(t, json.Unmarshal([]byte(*event.Message), &r))
+			assert.Equal(t, tc.expected, r.Fields)
+		})
+	}
+}
+
+func TestEntryToEventConverterWithExcludeFields(t *testing.T) {
+	timeUnixMilli := time.UnixMilli(int64(1722650790111))
+	now := func() time.Time {
+		return timeUnixMilli
+	}
+	entry, _ := getExampleEntryAndEvent(dummyInstanceID, timeUnixMilli, "cursor-0")
+	converter := NewEntryToEventConverter(dummyInstanceID, now, WithExcludeFields("_HOSTNAME", "_BOOT_ID"))
+	event := converter(entry)[0]
+	var r Record
+	assert.NoError(t, json.Unmarshal([]byte(*event.Message), &r))
+	assert.Empty(t, r.Hostname)
+	assert.Empty(t, r.BootID)
+	assert.Equal(t, "connection lost", r.Message)
+	// The entry is not modified.
+	assert.Equal(t, "hello-server1.us-west-2.amazon.com", entry.Fields["_HOSTNAME"])
+}
+
+func TestExtraFieldsPreferTrustedFields(t *testing.T) {
+	fields := map[string]string{"_COMM_NAME": "trusted", "COMM_NAME": "untrusted"}
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, map[string]string{"commName": "trusted"}, extraFields(fields, []string{AllFields}, FieldNamesCamel))
+	}
+}
+
+func TestExtraFieldsCollisions(t *testing.T) {
+	fields := map[string]string{
+		"FOO_BAR": "first", "FOO__BAR": "second", "_X__Y": "trusted second", "_X_Y": "trusted first",
+	}
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, map[string]string{"fooBar": "first", "xY": "trusted first"},
+			extraFields(fields, []string{AllFields}, FieldNamesCamel))
+	}
+}
+
+func TestCamelCase(t *testing.T) {
+	assert.Equal(t, "systemdUserUnit", camelCase("_SYSTEMD_USER_UNIT"))
+	assert.Equal(t, "requestId", camelCase("REQUEST_ID"))
+	assert.Equal(t, "cursor", camelCase("__CURSOR"))
+	assert.Equal(t, "codeLine", camelCase("CODE__LINE"))
+}
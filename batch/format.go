@@ -0,0 +1,140 @@
+package batch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Formats of log event messages.
+const (
+	// FormatJSON is the record in compact JSON.
+	FormatJSON = "json"
+
+	// FormatJSONPretty is the record in indented JSON, which was the only format before formats were added.
+	FormatJSONPretty = "json-pretty"
+
+	// FormatShort is the message with a short prefix, "<unit>[<pid>]: <message>", like `journalctl -o short` without
+	// the timestamp and host name that CWL has anyway. A part of a split message is marked with
+	// "[split <id> <part>/<parts>]" before the message, and a truncated message with "[truncated]".
+	FormatShort = "short"
+
+	// FormatLogfmt is the record in logfmt, with nested fields joined by dots, e.g. "syslog.ident=sshd".
+	FormatLogfmt = "logfmt"
+)
+
+// encodeRecord encodes the record in the format.
+func encodeRecord(r *Record, format string) (string, error) {
+	switch format {
+	case FormatJSON:
+		b, err := json.Marshal(r)
+		return string(b), err
+	case FormatShort:
+		return encodeShort(r), nil
+	case FormatLogfmt:
+		return encodeLogfmt(r)
+	default:
+		b, err := json.MarshalIndent(r, "", "  ")
+		return string(b), err
+	}
+}
+
+// encodeShort encodes the message prefixed by the unit, or the syslog identifier or command if the entry has no unit,
+// the pid if it is known, and the split or truncation marker if any, so split messages can be put back together.
+func encodeShort(r *Record) string {
+	var sb strings.Builder
+	name := r.SystemdUnit
+	if r.Container != nil && r.Container.Name != "" {
+		// Entries of all containers have the unit of the container engine.
+		name = r.Container.Name
+	}
+	if name == "" {
+		name = r.Syslog.Identifier
+	}
+	if name == "" {
+		name = r.Command
+	}
+	sb.WriteString(name)
+	pid := r.PID
+	if pid == 0 {
+		pid = r.Syslog.PID
+	}
+	if pid != 0 {
+		fmt.Fprintf(&sb, "[%d]", pid)
+	}
+	if sb.Len() > 0 {
+		sb.WriteString(": ")
+	}
+	if r.Split != nil {
+		fmt.Fprintf(&sb, "[split %s %d/%d] ", r.Split.ID, r.Split.Part, r.Split.Parts)
+	}
+	if r.Truncated {
+		sb.WriteString("[truncated] ")
+	}
+	sb.WriteString(r.Message)
+	return sb.String()
+}
+
+// encodeLogfmt encodes the record in logfmt. The record is encoded in JSON first, so the keys and the omitted fields
+// are the same as FormatJSON, and the fields keep their order.
+func encodeLogfmt(r *Record) (string, error) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var pairs []string
+	if err := flattenJSON(dec, "", &pairs); err != nil {
+		return "", err
+	}
+	return strings.Join(pairs, " "), nil
+}
+
+// flattenJSON reads the next JSON value from the decoder and appends it to pairs as "key=value", with keys of nested
+// values joined by dots and array elements keyed by their index. Null values are skipped.
+func flattenJSON(dec *json.Decoder, key string, pairs *[]string) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch v := tok.(type) {
+	case json.Delim:
+		for i := 0; dec.More(); i++ {
+			childKey := strconv.Itoa(i)
+			if v == '{' {
+				k, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				childKey = k.(string)
+			}
+			if key != "" {
+				childKey = key + "." + childKey
+			}
+			if err := flattenJSON(dec, childKey, pairs); err != nil {
+				return err
+			}
+		}
+		// Consume the closing delimiter.
+		_, err := dec.Token()
+		return err
+	case string:
+		*pairs = append(*pairs, key+"="+logfmtValue(v))
+	case json.Number:
+		*pairs = append(*pairs, key+"="+v.String())
+	case bool:
+		*pairs = append(*pairs, key+"="+strconv.FormatBool(v))
+	}
+	return nil
+}
+
+// logfmtValue quotes the value if it is empty or has spaces, quotes, equal signs or characters that are not printable.
+func logfmtValue(v string) string {
+	if v == "" || strings.ContainsAny(v, " \"=") || strconv.Quote(v) != `"`+v+`"` {
+		return strconv.Quote(v)
+	}
+	return v
+}
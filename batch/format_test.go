@@ -0,0 +1,73 @@
+package batch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEntryToEventConverterWithFormat(t *testing.T) {
+	timeUnixMilli := time.UnixMilli(int64(1722650790111))
+	now := func() time.Time {
+		return timeUnixMilli
+	}
+	entry, _ := getExampleEntryAndEvent(dummyInstanceID, timeUnixMilli, "cursor-0")
+
+	cases := []struct {
+		format   string
+		expected string
+	}{
+		{
+			format: FormatJSON,
+			expected: `{"instanceId":"i-11111111111111111","realTimestamp":1722650790111473,` +
+				`"entryId":"a1c5e8aaf32047d7","pid":1,"uid":2,"gid":3,` +
+				`"cmdName":"cowsay","systemdUnit":"sshd","bootId":"f595e6391111111111111111372bf520",` +
+				`"machineId":"ec22e31111111111111111111111115b","hostname":"hello-server1.us-west-2.amazon.com",` +
+				`"transport":"syslog","priority":"info","message":"connection lost",` +
+				`"syslog":{"facility":4,"ident":"sshd","pid":1}}`,
+		},
+		{
+			format:   FormatShort,
+			expected: "sshd[1]: connection lost",
+		},
+		{
+			format: FormatLogfmt,
+			expected: `instanceId=i-11111111111111111 realTimestamp=1722650790111473 entryId=a1c5e8aaf32047d7 pid=1 uid=2 ` +
+				`gid=3 cmdName=cowsay systemdUnit=sshd bootId=f595e6391111111111111111372bf520 ` +
+				`machineId=ec22e31111111111111111111111115b ` +
+				`hostname=hello-server1.us-west-2.amazon.com transport=syslog priority=info message="connection lost" ` +
+				`syslog.facility=4 syslog.ident=sshd syslog.pid=1`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.format, func(t *testing.T) {
+			converter := NewEntryToEventConverter(dummyInstanceID, now, WithFormat(tc.format))
+			event := converter(entry)[0]
+			assert.Equal(t, tc.expected, *event.Message)
+		})
+	}
+}
+
+func TestEncodeShort(t *testing.T) {
+	assert.Equal(t, "kernel: oops", encodeShort(&Record{Syslog: RecordSyslog{Identifier: "kernel"}, Message: "oops"}))
+	assert.Equal(t, "cron[42]: job", encodeShort(&Record{Command: "cron", Syslog: RecordSyslog{PID: 42}, Message: "job"}))
+	assert.Equal(t, "orphan", encodeShort(&Record{Message: "orphan"}))
+	// The entry id is left out.
+	assert.Equal(t, "sshd[1]: hi", encodeShort(&Record{EntryID: "0123456789abcdef", PID: 1,
+		Syslog: RecordSyslog{Identifier: "sshd"}, Message: "hi"}))
+	assert.Equal(t, "web[7]: hit", encodeShort(&Record{SystemdUnit: "docker.service", PID: 7,
+		Container: &RecordContainer{Name: "web"}, Message: "hit"}))
+	assert.Equal(t, "x.service[3]: [split 0123456789abcdef 2/3] def", encodeShort(&Record{SystemdUnit: "x.service",
+		PID: 3, Split: &RecordSplit{ID: "0123456789abcdef", Part: 2, Parts: 3}, Message: "def"}))
+	assert.Equal(t, "x.service[3]: [truncated] abc", encodeShort(&Record{SystemdUnit: "x.service", PID: 3,
+		Truncated: true, Message: "abc"}))
+}
+
+func TestLogfmtValue(t *testing.T) {
+	assert.Equal(t, "plain", logfmtValue("plain"))
+	assert.Equal(t, `""`, logfmtValue(""))
+	assert.Equal(t, `"a=b"`, logfmtValue("a=b"))
+	assert.Equal(t, `"say \"hi\""`, logfmtValue(`say "hi"`))
+	assert.Equal(t, `"line\nbreak"`, logfmtValue("line\nbreak"))
+}
@@ -0,0 +1,72 @@
+package batch
+
+import (
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+)
+
+// Limits of PutLogEvents, https://docs.aws.amazon.com/AmazonCloudWatchLogs/latest/APIReference/API_PutLogEvents.html
+// and https://docs.aws.amazon.com/AmazonCloudWatch/latest/logs/cloudwatch_limits_cwl.html. None of them can be changed.
+const (
+	// "The maximum batch size is 1,048,576 bytes. This size is calculated as the sum of all event messages in UTF-8,
+	// plus 26 bytes for each log event."
+	maxCWLBatchSize = 1024 * 1024
+
+	eventOverhead = 26
+
+	// "Event size: 256 KB (maximum)". The size includes the overhead, like the batch size.
+	maxCWLEventSize = 256 * 1024
+
+	// maxEventMessageSize is the maximum bytes of the message of a log event.
+	maxEventMessageSize = maxCWLEventSize - eventOverhead
+
+	// "The maximum number of log events in a batch is 10,000."
+	maxCWLBatchEvents = 10000
+
+	// "None of the log events in the batch can be more than 2 hours in the future."
+	maxEventAhead = 2 * time.Hour
+
+	// "None of the log events in the batch can be more than 14 days in the past."
+	maxEventAge = 14 * 24 * time.Hour
+
+	// "A batch of log events in a single request cannot span more than 24 hours."
+	maxBatchSpan = 24 * time.Hour
+
+	// timestampMargin keeps clamped timestamps valid until the batch is written, which may be delayed by retries.
+	timestampMargin = 10 * time.Minute
+)
+
+// eventSize returns the size of the event in a batch, the message in UTF-8 plus the overhead.
+func eventSize(event types.InputLogEvent) int {
+	return len(aws.ToString(event.Message)) + eventOverhead
+}
+
+// fitEvent makes the event valid on its own, or returns false if it cannot be. An event over maxCWLEventSize cannot be,
+// since cutting the encoded message would break its format. NewEntryToEventConverter cuts the message before it is
+// encoded instead, or replaces the record with a placeholder.
+// A timestamp that CWL would reject, older than maxEventAge or ahead by more than maxEventAhead, is clamped to now, so
+// the event is kept at the time it is shipped. The original time is in the message, e.g. realTimestamp.
+func fitEvent(event *types.InputLogEvent, now time.Time) bool {
+	if eventSize(*event) > maxCWLEventSize {
+		return false
+	}
+	ts := time.UnixMilli(aws.ToInt64(event.Timestamp))
+	if ts.Before(now.Add(-maxEventAge+timestampMargin)) || ts.After(now.Add(maxEventAhead-timestampMargin)) {
+		event.Timestamp = aws.Int64(now.UnixMilli())
+	}
+	return true
+}
+
+// truncateUTF8 returns the longest prefix of s that has at most n bytes and does not cut a UTF-8 character.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
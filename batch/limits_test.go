@@ -0,0 +1,173 @@
+package batch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/coreos/go-systemd/v22/sdjournal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFitEvent(t *testing.T) {
+	now := time.UnixMilli(int64(1722650790111))
+	cases := []struct {
+		name              string
+		message           string
+		timestamp         time.Time
+		expectedOK        bool
+		expectedTimestamp time.Time
+	}{
+		{"valid", "hello", now.Add(-time.Hour), true, now.Add(-time.Hour)},
+		{"too old", "hello", now.Add(-15 * 24 * time.Hour), true, now},
+		{"almost too old", "hello", now.Add(-maxEventAge + time.Second), true, now},
+		{"too new", "hello", now.Add(3 * time.Hour), true, now},
+		{"slightly ahead", "hello", now.Add(time.Minute), true, now.Add(time.Minute)},
+		{"biggest", strings.Repeat("a", maxCWLEventSize-eventOverhead), now, true, now},
+		{"too big", strings.Repeat("a", maxCWLEventSize-eventOverhead+1), now, false, now},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			event := types.InputLogEvent{
+				Message:   aws.String(tc.message),
+				Timestamp: aws.Int64(tc.timestamp.UnixMilli()),
+			}
+			assert.Equal(t, tc.expectedOK, fitEvent(&event, now))
+			// The message is never cut.
+			assert.Equal(t, tc.message, *event.Message)
+			assert.Equal(t, tc.expectedTimestamp.UnixMilli(), *event.Timestamp)
+		})
+	}
+}
+
+func TestTruncateUTF8(t *testing.T) {
+	assert.Equal(t, "héllo", truncateUTF8("héllo", 10))
+	assert.Equal(t, "h", truncateUTF8("héllo", 2))
+	assert.Equal(t, "hé", truncateUTF8("héllo", 3))
+	assert.Equal(t, "", truncateUTF8("世界", 2))
+}
+
+// TestBatchOnMaxCWLBatchSize tests that big log events never make a batch bigger than maxCWLBatchSize.
+func TestBatchOnMaxCWLBatchSize(t *testing.T) {
+	converter := func(e *sdjournal.JournalEntry) []types.InputLogEvent {
+		return []types.InputLogEvent{{
+			Message:   aws.String(e.Fields["MESSAGE"]),
+			Timestamp: aws.Int64(time.Now().UnixMilli()),
+		}}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	entriesChan := make(chan *sdjournal.JournalEntry)
+	go func() {
+		for i := 0; i < 10; i++ {
+			entriesChan <- &sdjournal.JournalEntry{
+				Cursor: fmt.Sprintf("cursor-%d", i),
+				Fields: map[string]string{"MESSAGE": strings.Repeat("a", maxCWLEventSize-eventOverhead)},
+			}
+		}
+	}()
+
+	batcher := NewBatcher(entriesChan, converter, WithMaxWait(time.Minute))
+	go batcher.Batch(ctx)
+
+	// Each log event is maxCWLEventSize, so four of them fill a batch.
+	batch := <-batcher.Batches()
+	assert.Equal(t, "cursor-3", batch.Cursor)
+	size := 0
+	for _, e := range batch.Events {
+		size += eventSize(e)
+	}
+	assert.Equal(t, maxCWLBatchSize, size)
+}
+
+func TestBatcherOptionsCapAtCWLLimits(t *testing.T) {
+	b := NewBatcher(nil, nil, WithMaxEvents(20000), WithMaxPayload(2*maxCWLBatchSize))
+	assert.Equal(t, maxCWLBatchEvents, b.maxEvents)
+	assert.Equal(t, maxCWLBatchSize, b.maxPayload)
+}
+
+// TestBatchDropsTooBigEvent tests that a log event over maxCWLEventSize is dropped, and the entry is not read again.
+func TestBatchDropsTooBigEvent(t *testing.T) {
+	converter := func(e *sdjournal.JournalEntry) []types.InputLogEvent {
+		return []types.InputLogEvent{{
+			Message:   aws.String(e.Fields["MESSAGE"]),
+			Timestamp: aws.Int64(time.Now().UnixMilli()),
+		}}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	entriesChan := make(chan *sdjournal.JournalEntry)
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		for i, message := range []string{"hello", strings.Repeat("a", maxCWLEventSize)} {
+			entriesChan <- &sdjournal.JournalEntry{
+				Cursor: fmt.Sprintf("cursor-%d", i),
+				Fields: map[string]string{"MESSAGE": message},
+			}
+		}
+	}()
+
+	batcher := NewBatcher(entriesChan, converter, WithMaxWait(time.Minute))
+	go batcher.Batch(ctx)
+
+	<-sent
+	cancel()
+	batch := <-batcher.Batches()
+	assert.Len(t, batch.Events, 1)
+	assert.Equal(t, "hello", *batch.Events[0].Message)
+	assert.Equal(t, "cursor-1", batch.Cursor)
+}
+
+// TestBatchReplacesTooBigRecord tests that a record that does not fit in a log event even without its message is
+// batched as a placeholder that tells the entry and the size of the record.
+func TestBatchReplacesTooBigRecord(t *testing.T) {
+	converter := NewEntryToEventConverter(dummyInstanceID, time.Now, WithFormat(FormatJSON),
+		WithIncludeFields(AllFields))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	entriesChan := make(chan *sdjournal.JournalEntry)
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		entriesChan <- &sdjournal.JournalEntry{Cursor: "cursor-0", Fields: map[string]string{"MESSAGE": "hello"}}
+		entriesChan <- &sdjournal.JournalEntry{
+			Cursor: "cursor-1",
+			Fields: map[string]string{
+				"MESSAGE":       "too big",
+				"_SYSTEMD_UNIT": "app.service",
+				"DUMP":          strings.Repeat("a", maxCWLEventSize),
+			},
+		}
+	}()
+
+	batcher := NewBatcher(entriesChan, converter, WithMaxWait(time.Minute))
+	go batcher.Batch(ctx)
+
+	<-sent
+	cancel()
+	batch := <-batcher.Batches()
+	assert.Equal(t, "cursor-1", batch.Cursor)
+	assert.Len(t, batch.Events, 2)
+	placeholder := batch.Events[1]
+	assert.LessOrEqual(t, eventSize(placeholder), maxCWLEventSize)
+	var r Record
+	assert.NoError(t, json.Unmarshal([]byte(*placeholder.Message), &r))
+	assert.Equal(t, Record{
+		InstanceID:     dummyInstanceID,
+		EntryID:        entryID("cursor-1"),
+		SystemdUnit:    "app.service",
+		Truncated:      true,
+		OriginalLength: len("too big"),
+		OriginalSize:   r.OriginalSize,
+	}, r)
+	assert.Greater(t, r.OriginalSize, maxCWLEventSize)
+}
@@ -0,0 +1,199 @@
+package batch
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Formats of structured messages, see WithMessageParsing.
+const (
+	// MessageFormatJSON is a message that is a JSON object.
+	MessageFormatJSON = "json"
+
+	// MessageFormatLogfmt is a message of logfmt pairs, e.g. `level=info msg="request served" status=200`. All values
+	// are strings.
+	MessageFormatLogfmt = "logfmt"
+)
+
+// parseMessage parses the message in the first of the formats that it is in, and returns the JSON object and the
+// format. It returns nil if the message is in none of the formats, or if the object is longer than maxSize bytes, so
+// it does not take more room in the log event than the message would.
+func parseMessage(message string, formats []string, maxSize int) (json.RawMessage, string) {
+	for _, format := range formats {
+		var parsed json.RawMessage
+		switch format {
+		case MessageFormatJSON:
+			parsed = parseJSONObject(message)
+		case MessageFormatLogfmt:
+			parsed = parseLogfmt(message)
+		}
+		if parsed == nil {
+			continue
+		}
+		if maxSize > 0 && len(parsed) > maxSize {
+			return nil, ""
+		}
+		return parsed, format
+	}
+	return nil, ""
+}
+
+// parseJSONObject returns the compacted message if it is a JSON object, or nil.
+func parseJSONObject(message string) json.RawMessage {
+	s := strings.TrimSpace(message)
+	if !strings.HasPrefix(s, "{") || !json.Valid([]byte(s)) {
+		return nil
+	}
+	var b bytes.Buffer
+	if err := json.Compact(&b, []byte(s)); err != nil {
+		return nil
+	}
+	return b.Bytes()
+}
+
+// parseLogfmt returns the message as a JSON object of strings if every word of the message is a key=value pair, or
+// nil. Values can be quoted, with Go escapes. If a key is repeated, the last value wins.
+func parseLogfmt(message string) json.RawMessage {
+	pairs := make(map[string]string)
+	s := strings.TrimSpace(message)
+	for len(s) > 0 {
+		eq := strings.IndexAny(s, "= \t\"")
+		if eq <= 0 || s[eq] != '=' {
+			return nil
+		}
+		key := s[:eq]
+		s = s[eq+1:]
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			end := closingQuote(s)
+			if end < 0 {
+				return nil
+			}
+			v, err := strconv.Unquote(s[:end+1])
+			if err != nil {
+				return nil
+			}
+			value = v
+			s = s[end+1:]
+			if len(s) > 0 && s[0] != ' ' && s[0] != '\t' {
+				return nil
+			}
+		} else {
+			end := strings.IndexAny(s, " \t")
+			if end < 0 {
+				end = len(s)
+			}
+			value = s[:end]
+			if strings.Contains(value, `"`) {
+				return nil
+			}
+			s = s[end:]
+		}
+		pairs[key] = value
+		s = strings.TrimLeft(s, " \t")
+	}
+	if len(pairs) == 0 {
+		return nil
+	}
+	b, err := json.Marshal(pairs)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+// closingQuote returns the index of the quote that closes the quote at the start of s, or -1.
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// parseRecord parses the message of the record with the parser bound to the entry with the fields, or in the message
+// formats if there is none. whole tells whether the record has the whole message, which is not split.
+func parseRecord(r *Record, fields map[string]string, whole bool, o *converterOptions) {
+	parsable := whole && !r.Truncated && utf8.ValidString(r.Message)
+	if p, ok := parserFor(o.parsers, fields); ok {
+		var parsed json.RawMessage
+		if parsable {
+			parsed = p.parse(r.Message)
+		}
+		// The message is kept, so both must fit in the room of the message.
+		if parsed == nil || o.maxMessageSize > 0 && len(r.Message)+len(parsed) > o.maxMessageSize {
+			r.Unparsed = p.Name
+			return
+		}
+		r.parsed, r.parsedKey, r.MessageFormat = parsed, o.parsedKey, p.Name
+		return
+	}
+	if len(o.messageFormats) == 0 || !parsable {
+		return
+	}
+	// The parsed object is at most as long as the message may be, so the log event stays within its limit.
+	if parsed, format := parseMessage(r.Message, o.messageFormats, o.maxMessageSize); parsed != nil {
+		r.parsed, r.parsedKey, r.MessageFormat = parsed, o.parsedKey, format
+		r.message, r.Message = r.Message, ""
+	}
+}
+
+// unparse leaves the parsed message out of the record, as if it was not parsed. The message of a parser is marked as
+// unparsed, and a message parsed in a message format is put back.
+func (r *Record) unparse() {
+	if r.message != "" {
+		r.Message = r.message
+	} else {
+		r.Unparsed = r.MessageFormat
+	}
+	r.parsed, r.parsedKey, r.MessageFormat, r.message = nil, "", "", ""
+}
+
+// RecordKeys returns the keys of the JSON encoded Record, which the key of parsed messages must not clash with, see
+// WithMessageParsing.
+func RecordKeys() []string {
+	t := reflect.TypeOf(Record{})
+	keys := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		key, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if !f.IsExported() || key == "-" {
+			continue
+		}
+		if key == "" {
+			key = f.Name
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// MarshalJSON encodes the record with the parsed message, if any, under its key.
+func (r Record) MarshalJSON() ([]byte, error) {
+	// record has the fields of Record but not its methods, so it is encoded as usual.
+	type record Record
+	b, err := json.Marshal(record(r))
+	if err != nil || r.parsed == nil {
+		return b, err
+	}
+	key, err := json.Marshal(r.parsedKey)
+	if err != nil {
+		return nil, err
+	}
+	b = b[:len(b)-1]
+	if len(b) > 1 {
+		b = append(b, ',')
+	}
+	b = append(b, key...)
+	b = append(b, ':')
+	b = append(b, r.parsed...)
+	return append(b, '}'), nil
+}
@@ -0,0 +1,215 @@
+package batch
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/sdjournal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMessage(t *testing.T) {
+	both := []string{MessageFormatJSON, MessageFormatLogfmt}
+	cases := []struct {
+		name           string
+		message        string
+		formats        []string
+		expectedParsed string
+		expectedFormat string
+	}{
+		{
+			name:           "json",
+			message:        ` {"level": "info", "status": 200, "tags": ["a"]} `,
+			formats:        both,
+			expectedParsed: `{"level":"info","status":200,"tags":["a"]}`,
+			expectedFormat: MessageFormatJSON,
+		},
+		{
+			name:           "logfmt",
+			message:        `level=info msg="request \"served\"" status=200 empty=`,
+			formats:        both,
+			expectedParsed: `{"empty":"","level":"info","msg":"request \"served\"","status":"200"}`,
+			expectedFormat: MessageFormatLogfmt,
+		},
+		{
+			name:    "json array",
+			message: `["a"]`,
+			formats: both,
+		},
+		{
+			name:    "invalid json",
+			message: `{"level": "info"`,
+			formats: []string{MessageFormatJSON},
+		},
+		{
+			name:    "text",
+			message: "user=alice logged in",
+			formats: both,
+		},
+		{
+			name:    "unterminated quote",
+			message: `msg="served`,
+			formats: both,
+		},
+		{
+			name:    "format not enabled",
+			message: "level=info",
+			formats: []string{MessageFormatJSON},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			parsed, format := parseMessage(tc.message, tc.formats, 0)
+			if tc.expectedParsed == "" {
+				assert.Nil(t, parsed)
+			} else {
+				assert.Equal(t, tc.expectedParsed, string(parsed))
+			}
+			assert.Equal(t, tc.expectedFormat, format)
+		})
+	}
+}
+
+func TestParseMessageMaxSize(t *testing.T) {
+	// The logfmt message fits, but its JSON object does not.
+	message := "a=1 b=2"
+	parsed, _ := parseMessage(message, []string{MessageFormatLogfmt}, len(message))
+	assert.Nil(t, parsed)
+	parsed, _ = parseMessage(message, []string{MessageFormatLogfmt}, 100)
+	assert.NotNil(t, parsed)
+}
+
+func TestEntryToEventConverterWithMessageParsing(t *testing.T) {
+	for _, format := range []string{FormatJSON, FormatJSONPretty} {
+		t.Run(format, func(t *testing.T) {
+			converter := NewEntryToEventConverter(dummyInstanceID, time.Now, WithFormat(format),
+				WithMessageParsing("data", MessageFormatJSON, MessageFormatLogfmt))
+
+			event := converter(&sdjournal.JournalEntry{Fields: map[string]string{
+				"MESSAGE": `{"level":"info","user":{"id":7}}`,
+				"_PID":    "42",
+			}})[0]
+			var m map[string]any
+			assert.NoError(t, json.Unmarshal([]byte(*event.Message), &m))
+			assert.Equal(t, map[string]any{"level": "info", "user": map[string]any{"id": float64(7)}}, m["data"])
+			assert.Equal(t, MessageFormatJSON, m["messageFormat"])
+			assert.Equal(t, float64(42), m["pid"])
+			assert.NotContains(t, m, "message")
+
+			// Messages that cannot be parsed stay as they are.
+			event = converter(&sdjournal.JournalEntry{Fields: map[string]string{"MESSAGE": "plain text"}})[0]
+			m = nil
+			assert.NoError(t, json.Unmarshal([]byte(*event.Message), &m))
+			assert.Equal(t, "plain text", m["message"])
+			assert.NotContains(t, m, "data")
+			assert.NotContains(t, m, "messageFormat")
+		})
+	}
+}
+
+func TestEntryToEventConverterWithMessageParsingLogfmt(t *testing.T) {
+	converter := NewEntryToEventConverter(dummyInstanceID, time.Now, WithFormat(FormatLogfmt),
+		WithMessageParsing("data", MessageFormatLogfmt))
+	event := converter(&sdjournal.JournalEntry{Fields: map[string]string{"MESSAGE": "level=info status=200"}})[0]
+	assert.Contains(t, *event.Message, "data.level=info data.status=200")
+}
+
+func TestEntryToEventConverterWithMessageParsingTruncated(t *testing.T) {
+	message := `{"msg":"` + strings.Repeat("a", 100) + `"}`
+	converter := NewEntryToEventConverter(dummyInstanceID, time.Now, WithMaxMessageSize(50),
+		WithMessageParsing("data", MessageFormatJSON))
+	event := converter(&sdjournal.JournalEntry{Fields: map[string]string{"MESSAGE": message}})[0]
+	var r Record
+	assert.NoError(t, json.Unmarshal([]byte(*event.Message), &r))
+	assert.True(t, r.Truncated)
+	assert.Equal(t, message[:50], r.Message)
+	assert.Empty(t, r.MessageFormat)
+}
+
+func TestRecordUnparse(t *testing.T) {
+	// Parsed in a message format, which replaces the message.
+	r := Record{parsed: json.RawMessage(`{"a":1}`), parsedKey: "data", MessageFormat: MessageFormatJSON,
+		message: `{"a": 1}`}
+	r.unparse()
+	assert.Equal(t, Record{Message: `{"a": 1}`}, r)
+
+	// Parsed by a parser, which keeps the message.
+	r = Record{parsed: json.RawMessage(`{"a":"1"}`), parsedKey: "data", MessageFormat: "app", Message: "a=1"}
+	r.unparse()
+	assert.Equal(t, Record{Message: "a=1", Unparsed: "app"}, r)
+}
+
+// TestEntryToEventConverterUnparsesToFit tests that a parsed message is left out when the encoded record would not fit
+// in a log event, since the parsed message is indented, while the escaped message fits.
+func TestEntryToEventConverterUnparsesToFit(t *testing.T) {
+	var pairs []string
+	for i := 0; i < 18000; i++ {
+		pairs = append(pairs, fmt.Sprintf(`"k%d":1`, i))
+	}
+	message := "{" + strings.Join(pairs, ",") + "}"
+	converter := NewEntryToEventConverter(dummyInstanceID, time.Now, WithMaxMessageSize(len(message)),
+		WithMessageParsing("data", MessageFormatJSON))
+	event := converter(&sdjournal.JournalEntry{Fields: map[string]string{"MESSAGE": message}})[0]
+	assert.LessOrEqual(t, eventSize(event), maxCWLEventSize)
+	var r Record
+	assert.NoError(t, json.Unmarshal([]byte(*event.Message), &r))
+	assert.Equal(t, message, r.Message)
+	assert.Empty(t, r.MessageFormat)
+	assert.False(t, r.Truncated)
+}
+
+// TestRecordKeys tests that the keys are those of a record with all fields set.
+func TestRecordKeys(t *testing.T) {
+	var r Record
+	v := reflect.ValueOf(&r).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		if !v.Type().Field(i).IsExported() {
+			continue
+		}
+		switch f.Kind() {
+		case reflect.String:
+			f.SetString("x")
+		case reflect.Int:
+			f.SetInt(1)
+		case reflect.Uint64:
+			f.SetUint(1)
+		case reflect.Bool:
+			f.SetBool(true)
+		case reflect.Slice:
+			f.Set(reflect.MakeSlice(f.Type(), 1, 1))
+		case reflect.Pointer:
+			f.Set(reflect.New(f.Type().Elem()))
+		case reflect.Map:
+			f.Set(reflect.MakeMap(f.Type()))
+			f.SetMapIndex(reflect.ValueOf("k"), reflect.ValueOf("v"))
+		case reflect.Struct:
+			// Structs are never omitted.
+		default:
+			t.Fatalf("cannot set field %s of kind %s", v.Type().Field(i).Name, f.Kind())
+		}
+	}
+	b, err := json.Marshal(r)
+	assert.NoError(t, err)
+	var m map[string]any
+	assert.NoError(t, json.Unmarshal(b, &m))
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	assert.ElementsMatch(t, keys, RecordKeys())
+}
+
+func TestRecordMarshalJSON(t *testing.T) {
+	b, err := json.Marshal(Record{parsed: json.RawMessage(`{"a":1}`), parsedKey: "data"})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"pid":0,"uid":0,"gid":0,"syslog":{},"data":{"a":1}}`, string(b))
+
+	b, err = json.Marshal(Record{Message: "m"})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"pid":0,"uid":0,"gid":0,"message":"m","syslog":{}}`, string(b))
+}
@@ -0,0 +1,138 @@
+package batch
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// grokPatterns are the patterns that parser expressions can refer to as "%{PATTERN}", or "%{PATTERN:name}" to extract
+// the match as the field name, like grok.
+var grokPatterns = map[string]string{
+	"WORD":              `\w+`,
+	"NOTSPACE":          `\S+`,
+	"SPACE":             `\s*`,
+	"DATA":              `.*?`,
+	"GREEDYDATA":        `.*`,
+	"INT":               `[+-]?\d+`,
+	"POSINT":            `\d+`,
+	"NUMBER":            `[+-]?(?:\d+(?:\.\d*)?|\.\d+)`,
+	"IP":                `(?:\d{1,3}(?:\.\d{1,3}){3}|[0-9A-Fa-f]*:[0-9A-Fa-f:.]+)`,
+	"HOSTNAME":          `[A-Za-z0-9][A-Za-z0-9._-]*`,
+	"IPORHOST":          `(?:\d{1,3}(?:\.\d{1,3}){3}|[0-9A-Fa-f]*:[0-9A-Fa-f:.]+|[A-Za-z0-9][A-Za-z0-9._-]*)`,
+	"USER":              `[A-Za-z0-9._@$-]+`,
+	"QS":                `"(?:[^"\\]|\\.)*"`,
+	"HTTPDATE":          `\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}`,
+	"TIMESTAMP_ISO8601": `\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?(?:Z|[+-]\d{2}:?\d{2})?`,
+}
+
+// builtinParsers are parser expressions for common daemons, which a parser expression can name instead of a pattern.
+var builtinParsers = map[string]string{
+	// The combined log format of nginx access logs.
+	"nginx": `^%{IPORHOST:remote_addr} - %{NOTSPACE:remote_user} \[%{HTTPDATE:time_local}\] ` +
+		`"%{WORD:method} %{NOTSPACE:path}(?: %{NOTSPACE:protocol})?" %{INT:status} %{INT:body_bytes_sent}` +
+		`(?: "%{DATA:referer}" "%{DATA:user_agent}")?`,
+
+	// The HTTP log format of HAProxy.
+	"haproxy": `^%{IP:client_ip}:%{INT:client_port} \[%{NOTSPACE:accept_date}\] %{NOTSPACE:frontend} ` +
+		`%{NOTSPACE:backend}/%{NOTSPACE:server} %{INT:time_request}/%{INT:time_queue}/%{INT:time_connect}/` +
+		`%{INT:time_response}/%{INT:time_active} %{INT:status} %{INT:bytes_read} %{NOTSPACE:request_cookie} ` +
+		`%{NOTSPACE:response_cookie} %{NOTSPACE:termination_state} %{INT:actconn}/%{INT:feconn}/%{INT:beconn}/` +
+		`%{INT:srv_conn}/%{INT:retries} %{INT:srv_queue}/%{INT:backend_queue}(?: \{%{DATA:request_headers}\})?` +
+		`(?: \{%{DATA:response_headers}\})? "%{WORD:method} %{NOTSPACE:path}(?: %{NOTSPACE:protocol})?"`,
+
+	// PostgreSQL with the default log_line_prefix, '%m [%p] ', optionally followed by '%q%u@%d '.
+	"postgres": `^(?:%{TIMESTAMP_ISO8601:timestamp}(?: %{WORD:timezone})? )?\[%{INT:pid}\] ` +
+		`(?:%{USER:user}@%{NOTSPACE:database} )?%{WORD:level}:\s+%{GREEDYDATA:text}`,
+
+	// Logins of sshd, e.g. "Accepted publickey for alice from 192.0.2.1 port 22 ssh2".
+	"sshd": `^(?:%{WORD:event} %{NOTSPACE:method} for (?:invalid user )?%{USER:user}|%{WORD:event} user ` +
+		`%{USER:user}) from %{IP:source_ip} port %{INT:source_port}`,
+}
+
+var grokReference = regexp.MustCompile(`%\{(\w+)(?::(\w+))?\}`)
+
+// Parser extracts the named submatches of Pattern from the messages of entries of the systemd unit or the syslog
+// identifier into the record. Submatches that do not participate in the match are left out.
+type Parser struct {
+	Name       string
+	Unit       string
+	Identifier string
+	Pattern    *regexp.Regexp
+}
+
+// NewParser returns a parser of the expression, which is the name of a built-in parser, "nginx", "haproxy", "postgres"
+// or "sshd", or a regex in the RE2 syntax with named submatches and grok references, see grokPatterns. Either unit or
+// identifier must be set.
+func NewParser(name, unit, identifier, expr string) (Parser, error) {
+	if unit == "" && identifier == "" {
+		return Parser{}, fmt.Errorf("parser %s needs a unit or an identifier", name)
+	}
+	if builtin, ok := builtinParsers[expr]; ok {
+		expr = builtin
+	}
+	var unknown []string
+	expanded := grokReference.ReplaceAllStringFunc(expr, func(ref string) string {
+		m := grokReference.FindStringSubmatch(ref)
+		pattern, ok := grokPatterns[m[1]]
+		if !ok {
+			unknown = append(unknown, m[1])
+			return ref
+		}
+		if m[2] == "" {
+			return "(?:" + pattern + ")"
+		}
+		return "(?P<" + m[2] + ">" + pattern + ")"
+	})
+	if len(unknown) > 0 {
+		return Parser{}, fmt.Errorf("unknown patterns %s in parser %s", strings.Join(unknown, ", "), name)
+	}
+	pattern, err := regexp.Compile(expanded)
+	if err != nil {
+		return Parser{}, fmt.Errorf("invalid regex in parser %s, %w", name, err)
+	}
+	return Parser{Name: name, Unit: unit, Identifier: identifier, Pattern: pattern}, nil
+}
+
+// appliesTo tells whether the parser is bound to the entry with the fields.
+func (p Parser) appliesTo(fields map[string]string) bool {
+	if p.Unit != "" && fields["_SYSTEMD_UNIT"] != p.Unit {
+		return false
+	}
+	if p.Identifier != "" && fields["SYSLOG_IDENTIFIER"] != p.Identifier {
+		return false
+	}
+	return true
+}
+
+// parse returns the named submatches of the message as a JSON object, or nil if the message does not match.
+func (p Parser) parse(message string) json.RawMessage {
+	m := p.Pattern.FindStringSubmatchIndex(message)
+	if m == nil {
+		return nil
+	}
+	fields := make(map[string]string)
+	for i, name := range p.Pattern.SubexpNames() {
+		// A name can be used in several alternatives, of which only one matches.
+		if name == "" || m[2*i] < 0 {
+			continue
+		}
+		fields[name] = message[m[2*i]:m[2*i+1]]
+	}
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+// parserFor returns the first parser bound to the entry with the fields.
+func parserFor(parsers []Parser, fields map[string]string) (Parser, bool) {
+	for _, p := range parsers {
+		if p.appliesTo(fields) {
+			return p, true
+		}
+	}
+	return Parser{}, false
+}
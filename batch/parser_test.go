@@ -0,0 +1,173 @@
+package batch
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/sdjournal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuiltinParsers(t *testing.T) {
+	cases := []struct {
+		parser   string
+		message  string
+		expected map[string]string
+	}{
+		{
+			parser: "nginx",
+			message: `192.0.2.1 - - [01/Oct/2024:12:00:00 +0000] "GET /index.html HTTP/1.1" 200 612 "-" ` +
+				`"curl/8.5.0"`,
+			expected: map[string]string{
+				"remote_addr": "192.0.2.1", "remote_user": "-", "time_local": "01/Oct/2024:12:00:00 +0000",
+				"method": "GET", "path": "/index.html", "protocol": "HTTP/1.1", "status": "200",
+				"body_bytes_sent": "612", "referer": "-", "user_agent": "curl/8.5.0",
+			},
+		},
+		{
+			parser: "haproxy",
+			message: `192.0.2.1:51234 [01/Oct/2024:12:00:00.123] web~ api/api1 0/0/1/12/13 200 345 - - ---- ` +
+				`1/1/0/0/0 0/0 "GET /health HTTP/1.1"`,
+			expected: map[string]string{
+				"client_ip": "192.0.2.1", "client_port": "51234", "accept_date": "01/Oct/2024:12:00:00.123",
+				"frontend": "web~", "backend": "api", "server": "api1", "time_request": "0", "time_queue": "0",
+				"time_connect": "1", "time_response": "12", "time_active": "13", "status": "200",
+				"bytes_read": "345", "request_cookie": "-", "response_cookie": "-", "termination_state": "----",
+				"actconn": "1", "feconn": "1", "beconn": "0", "srv_conn": "0", "retries": "0", "srv_queue": "0",
+				"backend_queue": "0", "method": "GET", "path": "/health", "protocol": "HTTP/1.1",
+			},
+		},
+		{
+			parser:  "postgres",
+			message: `2024-10-01 12:00:00.123 UTC [1234] LOG:  checkpoint starting: time`,
+			expected: map[string]string{
+				"timestamp": "2024-10-01 12:00:00.123", "timezone": "UTC", "pid": "1234", "level": "LOG",
+				"text": "checkpoint starting: time",
+			},
+		},
+		{
+			parser:  "sshd",
+			message: "Accepted publickey for alice from 192.0.2.1 port 52000 ssh2: ED25519 SHA256:abc",
+			expected: map[string]string{
+				"event": "Accepted", "method": "publickey", "user": "alice", "source_ip": "192.0.2.1",
+				"source_port": "52000",
+			},
+		},
+		{
+			parser:  "sshd",
+			message: "Invalid user admin from 192.0.2.2 port 40000",
+			expected: map[string]string{
+				"event": "Invalid", "user": "admin", "source_ip": "192.0.2.2", "source_port": "40000",
+			},
+		},
+		{
+			parser:  "sshd",
+			message: "pam_unix(sshd:session): session opened for user alice",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.parser, func(t *testing.T) {
+			p, err := NewParser(tc.parser, "", tc.parser, tc.parser)
+			assert.NoError(t, err)
+			parsed := p.parse(tc.message)
+			if tc.expected == nil {
+				assert.Nil(t, parsed)
+				return
+			}
+			var fields map[string]string
+			assert.NoError(t, json.Unmarshal(parsed, &fields))
+			assert.Equal(t, tc.expected, fields)
+		})
+	}
+}
+
+func TestNewParser(t *testing.T) {
+	p, err := NewParser("app", "app.service", "", `^%{WORD:level} \[%{INT}\] %{GREEDYDATA:text}$`)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"level":"info","text":"started"}`, string(p.parse("info [12] started")))
+
+	p, err = NewParser("app", "", "app", `^(?P<level>\w+): (?P<text>.*)`)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"level":"warn","text":"disk"}`, string(p.parse("warn: disk")))
+
+	_, err = NewParser("app", "", "", "nginx")
+	assert.Error(t, err)
+	_, err = NewParser("app", "app.service", "", "%{NOPE:x}")
+	assert.Error(t, err)
+	_, err = NewParser("app", "app.service", "", "(")
+	assert.Error(t, err)
+}
+
+func TestEntryToEventConverterWithParsers(t *testing.T) {
+	nginx, err := NewParser("nginx", "nginx.service", "", "nginx")
+	assert.NoError(t, err)
+	converter := NewEntryToEventConverter(dummyInstanceID, time.Now, WithFormat(FormatJSON),
+		WithParsers("data", nginx), WithMessageParsing("data", MessageFormatJSON))
+
+	message := `192.0.2.1 - - [01/Oct/2024:12:00:00 +0000] "GET / HTTP/1.1" 404 0 "-" "curl/8.5.0"`
+	event := converter(&sdjournal.JournalEntry{Fields: map[string]string{
+		"_SYSTEMD_UNIT": "nginx.service",
+		"MESSAGE":       message,
+	}})[0]
+	var m map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(*event.Message), &m))
+	assert.Equal(t, message, m["message"])
+	assert.Equal(t, "nginx", m["messageFormat"])
+	assert.Equal(t, "404", m["data"].(map[string]any)["status"])
+	assert.NotContains(t, m, "unparsed")
+
+	// An entry of the unit that does not match is marked.
+	event = converter(&sdjournal.JournalEntry{Fields: map[string]string{
+		"_SYSTEMD_UNIT": "nginx.service",
+		"MESSAGE":       "signal process started",
+	}})[0]
+	var r Record
+	assert.NoError(t, json.Unmarshal([]byte(*event.Message), &r))
+	assert.Equal(t, "nginx", r.Unparsed)
+	assert.Equal(t, "signal process started", r.Message)
+	assert.Empty(t, r.MessageFormat)
+
+	// Other entries are left to message parsing.
+	event = converter(&sdjournal.JournalEntry{Fields: map[string]string{
+		"_SYSTEMD_UNIT": "app.service",
+		"MESSAGE":       `{"a":"b"}`,
+	}})[0]
+	m = nil
+	assert.NoError(t, json.Unmarshal([]byte(*event.Message), &m))
+	assert.Equal(t, MessageFormatJSON, m["messageFormat"])
+	assert.NotContains(t, m, "unparsed")
+}
+
+func TestEntryToEventConverterWithParsersMaxMessageSize(t *testing.T) {
+	p, err := NewParser("app", "", "app", `^(?P<text>.*)$`)
+	assert.NoError(t, err)
+	converter := NewEntryToEventConverter(dummyInstanceID, time.Now, WithMaxMessageSize(20), WithParsers("data", p))
+	event := converter(&sdjournal.JournalEntry{Fields: map[string]string{
+		"SYSLOG_IDENTIFIER": "app",
+		"MESSAGE":           "0123456789",
+	}})[0]
+	var r Record
+	assert.NoError(t, json.Unmarshal([]byte(*event.Message), &r))
+	// The message and the parsed object do not fit in the room of the message together.
+	assert.Equal(t, "app", r.Unparsed)
+}
+
+func TestEntryToEventConverterWithParsersSplitMessages(t *testing.T) {
+	p, err := NewParser("app", "", "app", `^(?P<text>.*)$`)
+	assert.NoError(t, err)
+	converter := NewEntryToEventConverter(dummyInstanceID, time.Now, WithMaxMessageSize(4), WithSplitMessages(),
+		WithParsers("data", p))
+	events := converter(&sdjournal.JournalEntry{Fields: map[string]string{
+		"SYSLOG_IDENTIFIER": "app",
+		"MESSAGE":           "0123456789",
+	}})
+	assert.Len(t, events, 3)
+	// Every part of a split message is marked, since none of them is parsed.
+	for _, event := range events {
+		var r Record
+		assert.NoError(t, json.Unmarshal([]byte(*event.Message), &r))
+		assert.Equal(t, "app", r.Unparsed)
+		assert.NotNil(t, r.Split)
+	}
+}
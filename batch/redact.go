@@ -0,0 +1,79 @@
+package batch
+
+import (
+	"regexp"
+)
+
+// RedactionRule replaces the matches of Pattern with Replacement, which can refer to submatches like
+// regexp.Regexp.Expand. If Unit or Identifier is set, the rule only applies to entries of the systemd unit or the
+// syslog identifier.
+type RedactionRule struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+	Unit        string
+	Identifier  string
+}
+
+// appliesTo tells whether the rule applies to the entry with the fields.
+func (r RedactionRule) appliesTo(fields map[string]string) bool {
+	if r.Unit != "" && fields["_SYSTEMD_UNIT"] != r.Unit {
+		return false
+	}
+	if r.Identifier != "" && fields["SYSLOG_IDENTIFIER"] != r.Identifier {
+		return false
+	}
+	return true
+}
+
+// redact applies the rules to the given fields, and returns the redacted fields and the number of replaced matches.
+// The fields are not modified, they are copied if anything is replaced.
+func redact(fields map[string]string, redactFields []string, rules []RedactionRule) (map[string]string, int) {
+	count := 0
+	redacted := fields
+	for _, rule := range rules {
+		if !rule.appliesTo(fields) {
+			continue
+		}
+		for _, f := range redactFields {
+			v, ok := redacted[f]
+			if !ok {
+				continue
+			}
+			replaced, n := replaceAll(rule.Pattern, v, rule.Replacement)
+			if n == 0 {
+				continue
+			}
+			if count == 0 {
+				redacted = copyFields(fields)
+			}
+			redacted[f] = replaced
+			count += n
+		}
+	}
+	return redacted, count
+}
+
+// replaceAll is regexp.Regexp.ReplaceAllString that also returns the number of replaced matches.
+func replaceAll(re *regexp.Regexp, s string, replacement string) (string, int) {
+	matches := re.FindAllStringSubmatchIndex(s, -1)
+	if len(matches) == 0 {
+		return s, 0
+	}
+	var b []byte
+	last := 0
+	for _, m := range matches {
+		b = append(b, s[last:m[0]]...)
+		b = re.ExpandString(b, replacement, s, m)
+		last = m[1]
+	}
+	b = append(b, s[last:]...)
+	return string(b), len(matches)
+}
+
+func copyFields(fields map[string]string) map[string]string {
+	c := make(map[string]string, len(fields))
+	for k, v := range fields {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,86 @@
+package batch
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/sdjournal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEntryToEventConverterWithRedaction(t *testing.T) {
+	rules := []RedactionRule{
+		{Pattern: regexp.MustCompile(`(token=)\S+`), Replacement: "${1}***"},
+		{Pattern: regexp.MustCompile(`secret`), Replacement: "***", Unit: "app.service"},
+		{Pattern: regexp.MustCompile(`secret`), Replacement: "###", Identifier: "sudo"},
+	}
+	converter := NewEntryToEventConverter(dummyInstanceID, time.Now,
+		WithRedaction([]string{"MESSAGE", "_CMDLINE"}, rules...), WithIncludeFields("_CMDLINE"))
+
+	cases := []struct {
+		name               string
+		fields             map[string]string
+		expectedMessage    string
+		expectedCmdline    string
+		expectedRedactions int
+	}{
+		{
+			name:            "no match",
+			fields:          map[string]string{"MESSAGE": "hello"},
+			expectedMessage: "hello",
+		},
+		{
+			name: "message and field",
+			fields: map[string]string{
+				"MESSAGE":  "login token=abc and token=def",
+				"_CMDLINE": "app --token=xyz",
+			},
+			expectedMessage:    "login token=*** and token=***",
+			expectedCmdline:    "app --token=***",
+			expectedRedactions: 3,
+		},
+		{
+			name:               "scoped to unit",
+			fields:             map[string]string{"MESSAGE": "a secret", "_SYSTEMD_UNIT": "app.service"},
+			expectedMessage:    "a ***",
+			expectedRedactions: 1,
+		},
+		{
+			name:               "scoped to identifier",
+			fields:             map[string]string{"MESSAGE": "a secret", "SYSLOG_IDENTIFIER": "sudo"},
+			expectedMessage:    "a ###",
+			expectedRedactions: 1,
+		},
+		{
+			name:            "out of scope",
+			fields:          map[string]string{"MESSAGE": "a secret", "_SYSTEMD_UNIT": "other.service"},
+			expectedMessage: "a secret",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			original := copyFields(tc.fields)
+			event := converter(&sdjournal.JournalEntry{Fields: tc.fields})[0]
+			var r Record
+			assert.NoError(t, json.Unmarshal([]byte(*event.Message), &r))
+			assert.Equal(t, tc.expectedMessage, r.Message)
+			assert.Equal(t, tc.expectedCmdline, r.Fields["_CMDLINE"])
+			assert.Equal(t, tc.expectedRedactions, r.Redactions)
+			// The entry is not modified.
+			assert.Equal(t, original, tc.fields)
+		})
+	}
+}
+
+func TestReplaceAll(t *testing.T) {
+	re := regexp.MustCompile(`(\d+)-(\d+)`)
+	s, n := replaceAll(re, "1-2 and 3-4", "$2-$1")
+	assert.Equal(t, "2-1 and 4-3", s)
+	assert.Equal(t, 2, n)
+
+	s, n = replaceAll(re, "none", "x")
+	assert.Equal(t, "none", s)
+	assert.Equal(t, 0, n)
+}
@@ -0,0 +1,73 @@
+package batch
+
+import (
+	"unicode/utf8"
+)
+
+// RecordSplit links the records of a message that is split because it is longer than the maximum message size. The
+// message is the concatenation of the messages of parts 1 to Parts, after decoding them if they are encoded.
+type RecordSplit struct {
+	// ID is the same for all parts of the message, and for the parts of the same entry if it is shipped again. It is the
+	// entry id, see Record.EntryID.
+	ID string `json:"id"`
+
+	// Part is the index of the part, starting at 1.
+	Part int `json:"part"`
+
+	Parts int `json:"parts"`
+}
+
+// splitMessage splits the message into parts of at most n bytes at UTF-8 boundaries.
+func splitMessage(message string, n int) []string {
+	var parts []string
+	for len(message) > 0 {
+		part := firstPart(message, n)
+		parts = append(parts, part)
+		message = message[len(part):]
+	}
+	return parts
+}
+
+// firstPart returns the first part of the message of at most n bytes at a UTF-8 boundary, or the first character if n
+// is less than its size.
+func firstPart(message string, n int) string {
+	part := truncateUTF8(message, n)
+	if part == "" {
+		_, size := utf8.DecodeRuneInString(message)
+		part = message[:size]
+	}
+	return part
+}
+
+// splittable tells whether a part of the message of the record fits in a log event, i.e. the record of the first part
+// with only one character of the message.
+func splittable(r Record, id string, o *converterOptions) bool {
+	r.dropAuditFields()
+	r.Split = &RecordSplit{ID: id, Part: 1, Parts: len(r.Message)}
+	r.OriginalLength = len(r.Message)
+	r.Message = firstPart(r.Message, 0)
+	return eventFits(r, o)
+}
+
+// splitRecord returns a copy of the record per part of its message, linked by RecordSplit. A part has at most n bytes
+// of the message, and fewer if the encoded record would not fit in a log event otherwise.
+func splitRecord(r *Record, n int, id string, o *converterOptions) []*Record {
+	var records []*Record
+	for rest := r.Message; len(rest) > 0; {
+		part := *r
+		part.OriginalLength = len(r.Message)
+		// The number of parts is not known yet. The length of the message is more, so it takes at least as many digits.
+		part.Split = &RecordSplit{ID: id, Part: len(records) + 1, Parts: len(r.Message)}
+		part.Message, _, _ = fittingPrefix(part, firstPart(rest, n), o)
+		if part.Message == "" {
+			// Not even one character fits, so the log event is dropped anyway.
+			part.Message = firstPart(rest, 0)
+		}
+		records = append(records, &part)
+		rest = rest[len(part.Message):]
+	}
+	for _, part := range records {
+		part.Split.Parts = len(records)
+	}
+	return records
+}
@@ -0,0 +1,180 @@
+package batch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/sdjournal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitMessage(t *testing.T) {
+	assert.Equal(t, []string{"abc", "def", "g"}, splitMessage("abcdefg", 3))
+	assert.Equal(t, []string{"abc"}, splitMessage("abc", 3))
+	// Parts do not cut the 2-byte "é".
+	assert.Equal(t, []string{"ab", "éc", "d"}, splitMessage("abécd", 3))
+	// A character longer than the part size is a part of its own.
+	assert.Equal(t, []string{"世", "界"}, splitMessage("世界", 2))
+}
+
+func TestEntryToEventConverterWithSplitMessages(t *testing.T) {
+	converter := NewEntryToEventConverter(dummyInstanceID, time.Now, WithMaxMessageSize(4), WithSplitMessages())
+	entry := &sdjournal.JournalEntry{
+		Cursor: "cursor-0",
+		Fields: map[string]string{"MESSAGE": "0123456789", "_HOSTNAME": "host"},
+	}
+	events := converter(entry)
+	assert.Len(t, events, 3)
+
+	var message strings.Builder
+	for i, event := range events {
+		var r Record
+		assert.NoError(t, json.Unmarshal([]byte(*event.Message), &r))
+		assert.Equal(t, &RecordSplit{ID: entryID("cursor-0"), Part: i + 1, Parts: 3}, r.Split)
+		assert.Equal(t, 10, r.OriginalLength)
+		assert.False(t, r.Truncated)
+		assert.Equal(t, "host", r.Hostname)
+		message.WriteString(r.Message)
+	}
+	assert.Equal(t, "0123456789", message.String())
+
+	// A short message is not split.
+	entry.Fields["MESSAGE"] = "0123"
+	events = converter(entry)
+	assert.Len(t, events, 1)
+	var r Record
+	assert.NoError(t, json.Unmarshal([]byte(*events[0].Message), &r))
+	assert.Nil(t, r.Split)
+}
+
+// TestEntryToEventConverterWithSplitMessagesInShortFormat tests that the parts of a split message in the short format
+// are marked, so they can be told apart and put back together.
+func TestEntryToEventConverterWithSplitMessagesInShortFormat(t *testing.T) {
+	converter := NewEntryToEventConverter(dummyInstanceID, time.Now, WithMaxMessageSize(4), WithSplitMessages(),
+		WithFormat(FormatShort))
+	entry := &sdjournal.JournalEntry{
+		Cursor: "cursor-0",
+		Fields: map[string]string{"MESSAGE": "0123456789", "_SYSTEMD_UNIT": "x.service", "_PID": "3"},
+	}
+	var messages []string
+	for _, event := range converter(entry) {
+		messages = append(messages, *event.Message)
+	}
+	id := entryID("cursor-0")
+	assert.Equal(t, []string{
+		"x.service[3]: [split " + id + " 1/3] 0123",
+		"x.service[3]: [split " + id + " 2/3] 4567",
+		"x.service[3]: [split " + id + " 3/3] 89",
+	}, messages)
+}
+
+// TestBatchCursorOfSplitMessage tests that a batch has the cursor of an entry only if all log events of the entry are
+// in the batch or the batches before.
+func TestBatchCursorOfSplitMessage(t *testing.T) {
+	converter := NewEntryToEventConverter(dummyInstanceID, time.Now, WithMaxMessageSize(4), WithSplitMessages(),
+		WithFormat(FormatShort))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	entriesChan := make(chan *sdjournal.JournalEntry)
+	go func() {
+		// The first entry is one log event, the second is three.
+		for i, message := range []string{"0123", "0123456789"} {
+			entriesChan <- &sdjournal.JournalEntry{
+				Cursor: fmt.Sprintf("cursor-%d", i),
+				Fields: map[string]string{"MESSAGE": message},
+			}
+		}
+	}()
+
+	// The first log event is 4+26 bytes, and each part is 29+4+26 bytes with the split marker, so a batch has two parts
+	// or the first log event and a part.
+	batcher := NewBatcher(entriesChan, converter, WithMaxPayload(118), WithMaxWait(time.Minute))
+	go batcher.Batch(ctx)
+
+	batch := <-batcher.Batches()
+	assert.Len(t, batch.Events, 2)
+	assert.Equal(t, "cursor-0", batch.Cursor)
+	// The first batch is sent while batching the second entry, which is batched completely before ctx is checked.
+	cancel()
+	batch = <-batcher.Batches()
+	assert.Len(t, batch.Events, 2)
+	assert.Equal(t, "cursor-1", batch.Cursor)
+}
+
+// TestBatchCursorOfSplitMessageOnRestart tests that the batches before the last one of an entry that spans batches have
+// the cursor that the entries are read after, so the saved cursor does not move.
+func TestBatchCursorOfSplitMessageOnRestart(t *testing.T) {
+	converter := NewEntryToEventConverter(dummyInstanceID, time.Now, WithMaxMessageSize(4), WithSplitMessages(),
+		WithFormat(FormatShort))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	entriesChan := make(chan *sdjournal.JournalEntry)
+	go func() {
+		// The first entry after the saved cursor is three log events.
+		entriesChan <- &sdjournal.JournalEntry{Cursor: "cursor-1", Fields: map[string]string{"MESSAGE": "0123456789"}}
+	}()
+
+	// Each part is 29+4+26 bytes with the split marker, so a batch has two of them.
+	batcher := NewBatcher(entriesChan, converter, WithMaxPayload(118), WithMaxWait(time.Minute),
+		WithLastCursor("cursor-0"))
+	go batcher.Batch(ctx)
+
+	batch := <-batcher.Batches()
+	assert.Len(t, batch.Events, 2)
+	assert.Equal(t, "cursor-0", batch.Cursor)
+	cancel()
+	batch = <-batcher.Batches()
+	assert.Len(t, batch.Events, 1)
+	assert.Equal(t, "cursor-1", batch.Cursor)
+}
+
+// TestEntryToEventConverterSplitsEncodedRecord tests that each part of a split message fits in a log event after it is
+// encoded, including a message that fits in the maximum message size but not in a log event once encoded.
+func TestEntryToEventConverterSplitsEncodedRecord(t *testing.T) {
+	for _, size := range []int{500 * 1024, 200 * 1024} {
+		message := strings.Repeat(`"`, size)
+		converter := NewEntryToEventConverter(dummyInstanceID, time.Now, WithMaxMessageSize(200*1024),
+			WithSplitMessages(), WithFormat(FormatJSONPretty))
+		events := converter(&sdjournal.JournalEntry{Cursor: "cursor-0", Fields: map[string]string{"MESSAGE": message}})
+
+		var whole strings.Builder
+		for i, event := range events {
+			assert.LessOrEqual(t, eventSize(event), maxCWLEventSize)
+			var r Record
+			assert.NoError(t, json.Unmarshal([]byte(*event.Message), &r))
+			assert.Equal(t, &RecordSplit{ID: entryID("cursor-0"), Part: i + 1, Parts: len(events)}, r.Split)
+			assert.False(t, r.Truncated)
+			whole.WriteString(r.Message)
+		}
+		assert.Equal(t, message, whole.String())
+	}
+}
+
+// TestEntryToEventConverterDoesNotSplitTooBigFields tests that a record that does not fit in a log event even without
+// its message is replaced by one placeholder instead of being split.
+func TestEntryToEventConverterDoesNotSplitTooBigFields(t *testing.T) {
+	converter := NewEntryToEventConverter(dummyInstanceID, time.Now, WithMaxMessageSize(100), WithSplitMessages(),
+		WithFormat(FormatJSON), WithIncludeFields(AllFields))
+	events := converter(&sdjournal.JournalEntry{
+		Cursor: "cursor-0",
+		Fields: map[string]string{
+			"MESSAGE": strings.Repeat("a", 200),
+			"DUMP":    strings.Repeat("b", 300*1024),
+		},
+	})
+
+	assert.Len(t, events, 1)
+	assert.LessOrEqual(t, eventSize(events[0]), maxCWLEventSize)
+	var r Record
+	assert.NoError(t, json.Unmarshal([]byte(*events[0].Message), &r))
+	assert.True(t, r.Truncated)
+	assert.Nil(t, r.Split)
+	assert.Equal(t, 200, r.OriginalLength)
+	assert.Empty(t, r.Message)
+}
@@ -0,0 +1,173 @@
+package batch
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RecordKernel describes the device of entries of the kernel, from _KERNEL_DEVICE, _KERNEL_SUBSYSTEM, _UDEV_SYSNAME and
+// _UDEV_DEVNODE.
+type RecordKernel struct {
+	Device    string `json:"device,omitempty"`
+	Subsystem string `json:"subsystem,omitempty"`
+	SysName   string `json:"sysName,omitempty"`
+	DevNode   string `json:"devNode,omitempty"`
+}
+
+// RecordAudit describes an entry of the audit subsystem. Type is the numeric record type, e.g. 1400, and TypeName its
+// name, e.g. AVC. ID is the serial of the event, from _AUDIT_ID or "audit(<time>:<serial>):" in the message. Fields are
+// the key=value pairs of the message, with the pairs of a quoted msg='...' flattened into them. They repeat the
+// message, so they are left out of records whose message is cut or split, see Record.dropAuditFields. AVC is set for
+// SELinux access vector cache messages, e.g. denials.
+type RecordAudit struct {
+	Type     int               `json:"type,omitempty"`
+	TypeName string            `json:"typeName,omitempty"`
+	ID       string            `json:"id,omitempty"`
+	Fields   map[string]string `json:"fields,omitempty"`
+	AVC      *RecordAVC        `json:"avc,omitempty"`
+}
+
+// RecordAVC is a SELinux access vector cache message, e.g. "avc:  denied  { read write } for pid=42 ...". Result is
+// denied or granted.
+type RecordAVC struct {
+	Result      string   `json:"result"`
+	Permissions []string `json:"permissions,omitempty"`
+}
+
+// kernelAuditPrefix starts audit messages that the kernel logs when no audit daemon reads them, e.g.
+// "audit: type=1400 audit(1727784000.123:42): avc:  denied  { read } for ...".
+const kernelAuditPrefix = "audit: "
+
+var (
+	avcPattern = regexp.MustCompile(`\bavc:\s+(denied|granted)\s+\{\s*([^}]*?)\s*\}`)
+
+	auditTypeNamePattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]+$`)
+
+	auditIDPattern = regexp.MustCompile(`\baudit\([0-9]+\.[0-9]+:([0-9]+)\):`)
+)
+
+// kernelRecord returns the kernel device of the entry with the fields, or nil if it has none.
+func kernelRecord(f map[string]string) *RecordKernel {
+	k := RecordKernel{
+		Device:    f["_KERNEL_DEVICE"],
+		Subsystem: f["_KERNEL_SUBSYSTEM"],
+		SysName:   f["_UDEV_SYSNAME"],
+		DevNode:   f["_UDEV_DEVNODE"],
+	}
+	if k == (RecordKernel{}) {
+		return nil
+	}
+	return &k
+}
+
+// auditRecord decodes the audit message of the entry with the fields, or returns nil if the entry is not from the audit
+// subsystem.
+func auditRecord(f map[string]string) *RecordAudit {
+	message := f["MESSAGE"]
+	_, fromAudit := f["_AUDIT_TYPE"]
+	fromKernel := f["_TRANSPORT"] == "kernel" && strings.HasPrefix(message, kernelAuditPrefix)
+	if !fromAudit && !fromKernel {
+		return nil
+	}
+	a := RecordAudit{
+		TypeName: f["_AUDIT_TYPE_NAME"],
+		ID:       f["_AUDIT_ID"],
+	}
+	body := strings.TrimPrefix(message, kernelAuditPrefix)
+	if word, rest, _ := strings.Cut(body, " "); a.TypeName == "" && auditTypeNamePattern.MatchString(word) {
+		// journald prefixes the message with the name of the type, e.g. "SERVICE_START pid=1 ...".
+		a.TypeName = word
+		body = rest
+	}
+	a.Fields = auditPairs(body)
+	auditType := f["_AUDIT_TYPE"]
+	if auditType == "" {
+		auditType = a.Fields["type"]
+	}
+	a.Type, _ = strconv.Atoi(auditType)
+	if m := auditIDPattern.FindStringSubmatch(body); a.ID == "" && m != nil {
+		a.ID = m[1]
+	}
+	if m := avcPattern.FindStringSubmatch(body); m != nil {
+		a.AVC = &RecordAVC{Result: m[1], Permissions: strings.Fields(m[2])}
+	}
+	return &a
+}
+
+// auditPairs returns the key=value pairs of the audit message. Values can be double quoted, and a single quoted
+// msg='...' holds more pairs, which are added unless the message has the key already. Words that are not pairs, e.g.
+// "avc:" or "{ read }", are skipped.
+func auditPairs(s string) map[string]string {
+	pairs := make(map[string]string)
+	var nested []string
+	for len(s) > 0 {
+		s = strings.TrimLeft(s, " ")
+		end := strings.IndexByte(s, ' ')
+		if end < 0 {
+			end = len(s)
+		}
+		key, value, ok := strings.Cut(s[:end], "=")
+		if !ok || key == "" {
+			s = s[end:]
+			continue
+		}
+		// The value starts after "=".
+		s = s[len(key)+1:]
+		switch {
+		case strings.HasPrefix(value, `"`):
+			if i := strings.IndexByte(s[1:], '"'); i >= 0 {
+				value, s = s[1:i+1], s[i+2:]
+			} else {
+				value, s = s[1:], ""
+			}
+		case strings.HasPrefix(value, `'`):
+			if i := strings.IndexByte(s[1:], '\''); i >= 0 {
+				nested = append(nested, s[1:i+1])
+				s = s[i+2:]
+			} else {
+				nested = append(nested, s[1:])
+				s = ""
+			}
+			continue
+		default:
+			s = s[len(value):]
+		}
+		pairs[key] = value
+	}
+	for _, n := range nested {
+		for k, v := range auditPairs(n) {
+			if _, ok := pairs[k]; !ok {
+				pairs[k] = v
+			}
+		}
+	}
+	if len(pairs) == 0 {
+		return nil
+	}
+	return pairs
+}
+
+// auditFieldsSize returns the size of the JSON encoded audit fields of the record, 0 if it has none.
+func auditFieldsSize(r *Record) int {
+	if r.Audit == nil || r.Audit.Fields == nil {
+		return 0
+	}
+	b, err := json.Marshal(r.Audit.Fields)
+	if err != nil {
+		return 0
+	}
+	return len(b)
+}
+
+// dropAuditFields leaves the audit fields out of the record. The audit object is copied, since it is shared by the
+// parts of a split message.
+func (r *Record) dropAuditFields() {
+	if r.Audit == nil || r.Audit.Fields == nil {
+		return
+	}
+	a := *r.Audit
+	a.Fields = nil
+	r.Audit = &a
+}
@@ -0,0 +1,162 @@
+package batch
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/sdjournal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKernelRecord(t *testing.T) {
+	assert.Nil(t, kernelRecord(map[string]string{"MESSAGE": "hello"}))
+	assert.Equal(t, &RecordKernel{Device: "b8:0", Subsystem: "block", SysName: "sda", DevNode: "/dev/sda"},
+		kernelRecord(map[string]string{
+			"_KERNEL_DEVICE":    "b8:0",
+			"_KERNEL_SUBSYSTEM": "block",
+			"_UDEV_SYSNAME":     "sda",
+			"_UDEV_DEVNODE":     "/dev/sda",
+		}))
+}
+
+func TestAuditRecord(t *testing.T) {
+	cases := []struct {
+		name     string
+		fields   map[string]string
+		expected *RecordAudit
+	}{
+		{
+			name:   "not audit",
+			fields: map[string]string{"_TRANSPORT": "kernel", "MESSAGE": "usb 1-1: new device"},
+		},
+		{
+			name: "avc denial",
+			fields: map[string]string{
+				"_TRANSPORT":  "audit",
+				"_AUDIT_TYPE": "1400",
+				"_AUDIT_ID":   "42",
+				"MESSAGE": `AVC avc:  denied  { read write } for  pid=123 comm="httpd" name="index.html" ` +
+					`scontext=system_u:system_r:httpd_t:s0 tcontext=unconfined_u:object_r:user_home_t:s0 ` +
+					`tclass=file permissive=0`,
+			},
+			expected: &RecordAudit{
+				Type:     1400,
+				TypeName: "AVC",
+				ID:       "42",
+				Fields: map[string]string{
+					"pid": "123", "comm": "httpd", "name": "index.html", "scontext": "system_u:system_r:httpd_t:s0",
+					"tcontext": "unconfined_u:object_r:user_home_t:s0", "tclass": "file", "permissive": "0",
+				},
+				AVC: &RecordAVC{Result: "denied", Permissions: []string{"read", "write"}},
+			},
+		},
+		{
+			name: "nested msg",
+			fields: map[string]string{
+				"_TRANSPORT":       "audit",
+				"_AUDIT_TYPE":      "1130",
+				"_AUDIT_TYPE_NAME": "SERVICE_START",
+				"MESSAGE": `SERVICE_START pid=1 uid=0 auid=4294967295 msg='unit=nginx comm="systemd" ` +
+					`exe="/usr/lib/systemd/systemd" res=success'`,
+			},
+			expected: &RecordAudit{
+				Type:     1130,
+				TypeName: "SERVICE_START",
+				Fields: map[string]string{
+					"pid": "1", "uid": "0", "auid": "4294967295", "unit": "nginx", "comm": "systemd",
+					"exe": "/usr/lib/systemd/systemd", "res": "success",
+				},
+			},
+		},
+		{
+			name: "kernel audit",
+			fields: map[string]string{
+				"_TRANSPORT": "kernel",
+				"MESSAGE": `audit: type=1400 audit(1727784000.123:42): avc:  denied  { execmem } for  pid=7 ` +
+					`comm="java" permissive=1`,
+			},
+			expected: &RecordAudit{
+				Type:   1400,
+				ID:     "42",
+				Fields: map[string]string{"type": "1400", "pid": "7", "comm": "java", "permissive": "1"},
+				AVC:    &RecordAVC{Result: "denied", Permissions: []string{"execmem"}},
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, auditRecord(tc.fields))
+		})
+	}
+}
+
+func TestAuditPairs(t *testing.T) {
+	assert.Nil(t, auditPairs("no pairs here"))
+	assert.Equal(t, map[string]string{"a": "1", "b": "two words", "c": ""},
+		auditPairs(`a=1 b="two words" c=`))
+	// Unterminated quotes take the rest of the message.
+	assert.Equal(t, map[string]string{"a": "1", "b": "rest of"}, auditPairs(`a=1 b="rest of`))
+	// Keys of the message win over keys of msg.
+	assert.Equal(t, map[string]string{"pid": "1", "res": "failed"}, auditPairs(`pid=1 msg='pid=2 res=failed'`))
+}
+
+func TestEntryToEventConverterWithTransports(t *testing.T) {
+	converter := NewEntryToEventConverter(dummyInstanceID, time.Now, WithIncludeFields(AllFields))
+	event := converter(&sdjournal.JournalEntry{Fields: map[string]string{
+		"_TRANSPORT":        "kernel",
+		"_KERNEL_DEVICE":    "b8:0",
+		"_KERNEL_SUBSYSTEM": "block",
+		"MESSAGE":           "sda: I/O error",
+	}})[0]
+	var r Record
+	assert.NoError(t, json.Unmarshal([]byte(*event.Message), &r))
+	assert.Equal(t, &RecordKernel{Device: "b8:0", Subsystem: "block"}, r.Kernel)
+	assert.Nil(t, r.Audit)
+	assert.Empty(t, r.Fields)
+
+	event = converter(&sdjournal.JournalEntry{Fields: map[string]string{
+		"_TRANSPORT":  "audit",
+		"_AUDIT_TYPE": "1400",
+		"MESSAGE":     `AVC avc:  denied  { read } for pid=1 tclass=file`,
+	}})[0]
+	var m map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(*event.Message), &m))
+	audit := m["audit"].(map[string]any)
+	assert.Equal(t, "denied", audit["avc"].(map[string]any)["result"])
+	assert.Equal(t, "file", audit["fields"].(map[string]any)["tclass"])
+	assert.NotContains(t, m, "kernel")
+}
+
+func TestEntryToEventConverterDropsAuditFields(t *testing.T) {
+	fields := map[string]string{
+		"_TRANSPORT":  "audit",
+		"_AUDIT_TYPE": "1400",
+		"_AUDIT_ID":   "42",
+		"MESSAGE":     `AVC avc:  denied  { read } for pid=1 tclass=file`,
+	}
+	cases := []struct {
+		name           string
+		opts           []ConverterOption
+		expectedFields map[string]string
+	}{
+		{"room for the fields", []ConverterOption{WithMaxMessageSize(100)}, map[string]string{"pid": "1", "tclass": "file"}},
+		// The message fits, but not with the fields.
+		{"no room for the fields", []ConverterOption{WithMaxMessageSize(60)}, nil},
+		{"truncated", []ConverterOption{WithMaxMessageSize(20)}, nil},
+		{"split", []ConverterOption{WithMaxMessageSize(20), WithSplitMessages()}, nil},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			converter := NewEntryToEventConverter(dummyInstanceID, time.Now, tc.opts...)
+			for _, event := range converter(&sdjournal.JournalEntry{Fields: fields}) {
+				var r Record
+				assert.NoError(t, json.Unmarshal([]byte(*event.Message), &r))
+				// The other audit fields are kept.
+				assert.Equal(t, "42", r.Audit.ID)
+				assert.Equal(t, "denied", r.Audit.AVC.Result)
+				assert.Equal(t, tc.expectedFields, r.Audit.Fields)
+			}
+		})
+	}
+}
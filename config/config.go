@@ -2,13 +2,103 @@ package config
 
 import (
 	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/spf13/viper"
+
+	"snappydevtools.com/journald-to-cwl/batch"
 )
 
 const (
 	DefaultLogGroup  = "journal-logs"
 	DefaultStateFile = "/var/lib/journald-to-cwl/state"
+
+	DefaultMaxReadFailures = 10
+
+	// AllNamespaces in Namespaces selects all journal namespaces.
+	AllNamespaces = "*"
+
+	// DefaultDataThreshold is the default of sd-journal.
+	DefaultDataThreshold = 64 * 1024
+
+	DefaultBinaryEncoding = batch.BinaryEncodingReplace
+
+	DefaultLagInterval = 5 * time.Minute
+
+	DefaultFormat = batch.FormatJSONPretty
+
+	// AllFields in Fields selects all journal fields.
+	AllFields = batch.AllFields
+
+	DefaultFieldNames = batch.FieldNamesNative
+
+	DefaultTimestamp = batch.TimestampRead
+
+	DefaultDetectorAction = batch.DetectionMask
+
+	DefaultParseMessageKey = "data"
+
+	DefaultMultilineTimeout = time.Second
+
+	DefaultMultilineMaxLines = 1000
+
+	// AllDetectors in Detectors enables all detectors.
+	AllDetectors = batch.AllDetectors
+
+	// DefaultMaxMessageSize leaves room in the 256 KB log event for the other fields of the record.
+	DefaultMaxMessageSize = 192 * 1024
+)
+
+// Journals to read, see Config.Journals.
+const (
+	// JournalLocal is the journal of the local machine, the system and user journals.
+	JournalLocal = "local"
+
+	// JournalSystem is the system journal of the local machine, without user journals.
+	JournalSystem = "system"
+
+	// JournalUserPrefix followed by a user name or uid is the journal of the user.
+	JournalUserPrefix = "user:"
+
+	// JournalContainerPrefix followed by a machine id, or AllContainers, is the journal of a systemd-nspawn container.
+	JournalContainerPrefix = "container:"
+
+	// AllContainers after JournalContainerPrefix selects the journals of all containers.
+	AllContainers = "*"
+)
+
+// binaryEncodings are the accepted BinaryEncoding values.
+var binaryEncodings = []string{batch.BinaryEncodingReplace, batch.BinaryEncodingBase64, batch.BinaryEncodingHex}
+
+// formats are the accepted Format values.
+var formats = []string{batch.FormatJSON, batch.FormatJSONPretty, batch.FormatShort, batch.FormatLogfmt}
+
+// fieldNames are the accepted FieldNames values.
+var fieldNames = []string{batch.FieldNamesNative, batch.FieldNamesCamel}
+
+// detectors are the accepted Detectors values besides AllDetectors.
+var detectors = batch.DetectorNames()
+
+// detectorActions are the accepted DetectorAction values.
+var detectorActions = []string{batch.DetectionMask, batch.DetectionHash}
+
+// messageFormats are the accepted ParseMessage values.
+var messageFormats = []string{batch.MessageFormatJSON, batch.MessageFormatLogfmt}
+
+var recordKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// timestamps are the accepted Timestamp values.
+var timestamps = []string{batch.TimestampRead, batch.TimestampRealtime, batch.TimestampSource}
+
+var namespacePattern = regexp.MustCompile(`^[A-Za-z0-9_.:-]+$`)
+
+var (
+	userPattern = regexp.MustCompile(`^[A-Za-z0-9_.][A-Za-z0-9_.-]*\$?$`)
+
+	machineIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
 )
 
 type Config struct {
@@ -17,6 +107,114 @@ type Config struct {
 	LogStream string `mapstructure:"log_stream"`
 
 	StateFile string `mapstructure:"state_file"`
+
+	// Matches is a journalctl-style match expression that filters journal entries, see ParseMatches.
+	Matches string `mapstructure:"matches"`
+
+	// JournalDirectory is a directory to read journal files from, instead of the local system journal. For example,
+	// /var/log/journal/remote populated by systemd-journal-remote.
+	JournalDirectory string `mapstructure:"journal_directory"`
+
+	// JournalFiles is a list of journal files to read, instead of the local system journal.
+	JournalFiles []string `mapstructure:"journal_files"`
+
+	// ExportFile is a file in the Journal Export Format, or "-" for the standard input, to read instead of the local
+	// system journal.
+	ExportFile string `mapstructure:"export_file"`
+
+	// Namespaces are journald namespaces to read in addition to the default journal, or AllNamespaces.
+	Namespaces []string `mapstructure:"namespaces"`
+
+	// Journals are the journals to read instead of the local journal, each with its own cursor: JournalLocal,
+	// JournalSystem, "user:<name or uid>" or "container:<machine-id>". Empty reads the local journal.
+	Journals []string `mapstructure:"journals"`
+
+	// StartPosition is where to start reading when there is no cursor or the cursor cannot be sought to, see
+	// ParseStartPosition.
+	StartPosition string `mapstructure:"start_position"`
+
+	// DataThreshold is the maximum bytes of a journal field to read, 0 for unlimited. Longer fields are truncated.
+	DataThreshold int `mapstructure:"data_threshold"`
+
+	// BinaryEncoding is how to encode messages that are not valid UTF-8, one of replace, base64 and hex.
+	BinaryEncoding string `mapstructure:"binary_encoding"`
+
+	// MaxMessageSize is the maximum bytes of a message, 0 for unlimited. Longer messages are truncated.
+	MaxMessageSize int `mapstructure:"max_message_size"`
+
+	// SplitMessages splits messages longer than MaxMessageSize into several log events instead of truncating them.
+	SplitMessages bool `mapstructure:"split_messages"`
+
+	// Format is the format of log event messages, one of json, json-pretty, short and logfmt.
+	Format string `mapstructure:"format"`
+
+	// Fields are the journal fields to add to log events in addition to the common ones, or AllFields.
+	Fields []string `mapstructure:"fields"`
+
+	// ExcludeFields are the journal fields to leave out of log events.
+	ExcludeFields []string `mapstructure:"exclude_fields"`
+
+	// FieldNames is how to name the added fields, native, e.g. REQUEST_ID, or camel, e.g. requestId.
+	FieldNames string `mapstructure:"field_names"`
+
+	// Timestamp is the timestamp of log events, the time the entry is read, the time journald received the entry
+	// (realtime) or the time the entry was logged at the source (source).
+	Timestamp string `mapstructure:"timestamp"`
+
+	// RedactFields are the journal fields that RedactionRules apply to.
+	RedactFields []string `mapstructure:"redact_fields"`
+
+	// Detectors are the built-in detectors of secrets and personal data to enable, or AllDetectors.
+	Detectors []string `mapstructure:"detectors"`
+
+	// DetectorAction is what to replace detected data with, a mask (mask) or a hash keyed by DetectorHashKey (hash).
+	DetectorAction  string `mapstructure:"detector_action"`
+	DetectorHashKey string `mapstructure:"detector_hash_key"`
+
+	// ParseMessage are the formats, json or logfmt, to parse messages in, tried in order. Parsed messages are put under
+	// ParseMessageKey instead of the message, and so are the fields that Parsers extract.
+	ParseMessage    []string `mapstructure:"parse_message"`
+	ParseMessageKey string   `mapstructure:"parse_message_key"`
+
+	// AuthEvents adds the normalized authentication and privilege events of sshd, sudo, su and pam_unix to log events.
+	AuthEvents bool `mapstructure:"auth_events"`
+
+	// MultilineStart and MultilineContinue are the regular expressions of the first line of a multi-line message, and
+	// of the lines that continue it. Consecutive entries of a unit and PID are merged if either is set.
+	MultilineStart    string `mapstructure:"multiline_start"`
+	MultilineContinue string `mapstructure:"multiline_continue"`
+
+	// MultilineUnits are the units, by _SYSTEMD_UNIT or SYSLOG_IDENTIFIER, whose entries are merged. All if empty.
+	MultilineUnits []string `mapstructure:"multiline_units"`
+
+	// MultilineTimeout is how long to wait for the next line of a message.
+	MultilineTimeout time.Duration `mapstructure:"multiline_timeout"`
+
+	// MultilineMaxLines is the maximum number of lines merged into one message.
+	MultilineMaxLines int `mapstructure:"multiline_max_lines"`
+
+	// LagInterval is how often to measure and log the lag of reading behind the newest journal entry, 0 to disable.
+	LagInterval time.Duration `mapstructure:"lag_interval"`
+
+	// MaxReadFailures is the number of consecutive journal read failures to give up after.
+	MaxReadFailures int `mapstructure:"max_read_failures"`
+
+	// MatchGroups is the parsed Matches.
+	MatchGroups [][]string `mapstructure:"-"`
+
+	// Start is the parsed StartPosition.
+	Start StartPosition `mapstructure:"-"`
+
+	// RedactionRules are parsed from the keys that start with RedactionRulePrefix, see ParseRedactionRule.
+	RedactionRules []RedactionRule `mapstructure:"-"`
+
+	// Parsers are parsed from the keys that start with ParserPrefix, see ParseParserRule, and compiled.
+	Parsers []batch.Parser `mapstructure:"-"`
+
+	// MultilineStartPattern and MultilineContinuePattern are the parsed MultilineStart and MultilineContinue, nil if
+	// they are not set.
+	MultilineStartPattern    *regexp.Regexp `mapstructure:"-"`
+	MultilineContinuePattern *regexp.Regexp `mapstructure:"-"`
 }
 
 func InitalizeConfig(instanceID string, args []string) (*Config, error) {
@@ -24,6 +222,20 @@ func InitalizeConfig(instanceID string, args []string) (*Config, error) {
 	v := viper.New()
 	v.SetDefault("log_group", DefaultLogGroup)
 	v.SetDefault("state_file", DefaultStateFile)
+	v.SetDefault("max_read_failures", DefaultMaxReadFailures)
+	v.SetDefault("start_position", DefaultStartPosition)
+	v.SetDefault("data_threshold", DefaultDataThreshold)
+	v.SetDefault("binary_encoding", DefaultBinaryEncoding)
+	v.SetDefault("max_message_size", DefaultMaxMessageSize)
+	v.SetDefault("format", DefaultFormat)
+	v.SetDefault("field_names", DefaultFieldNames)
+	v.SetDefault("timestamp", DefaultTimestamp)
+	v.SetDefault("redact_fields", DefaultRedactFields)
+	v.SetDefault("detector_action", DefaultDetectorAction)
+	v.SetDefault("lag_interval", DefaultLagInterval)
+	v.SetDefault("parse_message_key", DefaultParseMessageKey)
+	v.SetDefault("multiline_timeout", DefaultMultilineTimeout)
+	v.SetDefault("multiline_max_lines", DefaultMultilineMaxLines)
 	if len(args) >= 1 {
 		configFile := args[0]
 		v.SetConfigType("env")
@@ -35,8 +247,198 @@ func InitalizeConfig(instanceID string, args []string) (*Config, error) {
 	if err := v.Unmarshal(&c); err != nil {
 		return nil, fmt.Errorf("cannot unmarshal config, %w", err)
 	}
-	if c.LogStream == "" {
+	if c.DataThreshold < 0 {
+		return nil, fmt.Errorf("data_threshold must not be negative, got %d", c.DataThreshold)
+	}
+	if !slices.Contains(binaryEncodings, c.BinaryEncoding) {
+		return nil, fmt.Errorf("binary_encoding must be one of %v, got %q", binaryEncodings, c.BinaryEncoding)
+	}
+	if c.MaxMessageSize < 0 {
+		return nil, fmt.Errorf("max_message_size must not be negative, got %d", c.MaxMessageSize)
+	}
+	if c.SplitMessages && c.MaxMessageSize == 0 {
+		return nil, fmt.Errorf("split_messages needs max_message_size")
+	}
+	if !slices.Contains(formats, c.Format) {
+		return nil, fmt.Errorf("format must be one of %v, got %q", formats, c.Format)
+	}
+	for _, f := range c.Fields {
+		if f != AllFields && !matchFieldPattern.MatchString(f) {
+			return nil, fmt.Errorf("invalid field %q in fields", f)
+		}
+	}
+	for _, f := range c.ExcludeFields {
+		if !matchFieldPattern.MatchString(f) {
+			return nil, fmt.Errorf("invalid field %q in exclude_fields", f)
+		}
+	}
+	if !slices.Contains(fieldNames, c.FieldNames) {
+		return nil, fmt.Errorf("field_names must be one of %v, got %q", fieldNames, c.FieldNames)
+	}
+	if !slices.Contains(timestamps, c.Timestamp) {
+		return nil, fmt.Errorf("timestamp must be one of %v, got %q", timestamps, c.Timestamp)
+	}
+	for _, f := range c.RedactFields {
+		if !matchFieldPattern.MatchString(f) {
+			return nil, fmt.Errorf("invalid field %q in redact_fields", f)
+		}
+	}
+	for _, d := range c.Detectors {
+		if d != AllDetectors && !slices.Contains(detectors, d) {
+			return nil, fmt.Errorf("detectors must be in %v, got %q", detectors, d)
+		}
+	}
+	if !slices.Contains(detectorActions, c.DetectorAction) {
+		return nil, fmt.Errorf("detector_action must be one of %v, got %q", detectorActions, c.DetectorAction)
+	}
+	if c.DetectorAction == batch.DetectionHash && len(c.Detectors) > 0 && c.DetectorHashKey == "" {
+		return nil, fmt.Errorf("detector_action hash needs detector_hash_key")
+	}
+	settings := make(map[string]string)
+	for _, k := range v.AllKeys() {
+		settings[k] = v.GetString(k)
+	}
+	rules, err := parseRedactionRules(settings)
+	if err != nil {
+		return nil, err
+	}
+	c.RedactionRules = rules
+	parsers, err := parseParserRules(settings)
+	if err != nil {
+		return nil, err
+	}
+	c.Parsers = parsers
+	for _, f := range c.ParseMessage {
+		if !slices.Contains(messageFormats, f) {
+			return nil, fmt.Errorf("parse_message must be in %v, got %q", messageFormats, f)
+		}
+	}
+	if !recordKeyPattern.MatchString(c.ParseMessageKey) || slices.Contains(batch.RecordKeys(), c.ParseMessageKey) {
+		return nil, fmt.Errorf("invalid parse_message_key %q", c.ParseMessageKey)
+	}
+	if c.MultilineStart != "" {
+		re, err := regexp.Compile(c.MultilineStart)
+		if err != nil {
+			return nil, fmt.Errorf("invalid multiline_start, %w", err)
+		}
+		c.MultilineStartPattern = re
+	}
+	if c.MultilineContinue != "" {
+		re, err := regexp.Compile(c.MultilineContinue)
+		if err != nil {
+			return nil, fmt.Errorf("invalid multiline_continue, %w", err)
+		}
+		c.MultilineContinuePattern = re
+	}
+	if c.MultilineTimeout <= 0 {
+		return nil, fmt.Errorf("multiline_timeout must be positive, got %s", c.MultilineTimeout)
+	}
+	if c.MultilineMaxLines <= 0 {
+		return nil, fmt.Errorf("multiline_max_lines must be positive, got %d", c.MultilineMaxLines)
+	}
+	if c.LagInterval < 0 {
+		return nil, fmt.Errorf("lag_interval must not be negative, got %s", c.LagInterval)
+	}
+	if c.MaxReadFailures < 0 {
+		return nil, fmt.Errorf("max_read_failures must not be negative, got %d", c.MaxReadFailures)
+	}
+	numInputs := 0
+	for _, set := range []bool{c.JournalDirectory != "", len(c.JournalFiles) > 0, c.ExportFile != ""} {
+		if set {
+			numInputs++
+		}
+	}
+	if numInputs > 1 {
+		return nil, fmt.Errorf("only one of journal_directory, journal_files and export_file can be used")
+	}
+	if c.ExportFile != "" && c.Matches != "" {
+		return nil, fmt.Errorf("matches cannot be used with export_file")
+	}
+	if len(c.Namespaces) > 0 && c.ReadsJournalFiles() {
+		return nil, fmt.Errorf("namespaces cannot be used with journal_directory, journal_files or export_file")
+	}
+	for _, ns := range c.Namespaces {
+		if ns != AllNamespaces && !namespacePattern.MatchString(ns) {
+			return nil, fmt.Errorf("invalid namespace %q", ns)
+		}
+	}
+	if len(c.Journals) > 0 && c.ReadsJournalFiles() {
+		return nil, fmt.Errorf("journals cannot be used with journal_directory, journal_files or export_file")
+	}
+	if err := validateJournals(c.Journals); err != nil {
+		return nil, err
+	}
+	groups, err := ParseMatches(c.Matches)
+	if err != nil {
+		return nil, err
+	}
+	c.MatchGroups = groups
+	if c.Start, err = ParseStartPosition(c.StartPosition); err != nil {
+		return nil, err
+	}
+	if c.ExportFile != "" && c.Start.Kind != StartHead && c.Start.Kind != StartSince {
+		return nil, fmt.Errorf("start_position %s cannot be used with export_file", c.StartPosition)
+	}
+	// The current boot is the boot of the local machine, so it cannot be found in the journals of other machines.
+	if c.Start.Kind == StartCurrentBoot && (c.ReadsJournalFiles() || readsContainerJournals(c.Journals)) {
+		return nil, fmt.Errorf("start_position %s cannot be used with journal_directory, journal_files, export_file "+
+			"or container journals", c.StartPosition)
+	}
+	// When reading journals of another machine, the log stream defaults to the source machine id that is only known
+	// after opening the journal.
+	if c.LogStream == "" && !c.ReadsJournalFiles() {
 		c.LogStream = instanceID
 	}
 	return &c, nil
 }
+
+// ReadsJournalFiles tells whether journals are read from a directory, files or an export instead of the local system
+// journal.
+func (c *Config) ReadsJournalFiles() bool {
+	return c.JournalDirectory != "" || len(c.JournalFiles) > 0 || c.ExportFile != ""
+}
+
+// readsContainerJournals tells whether the journals include journals of containers, which are other machines.
+func readsContainerJournals(journals []string) bool {
+	for _, j := range journals {
+		if strings.HasPrefix(j, JournalContainerPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateJournals checks the values of Config.Journals. The local journal includes the system and user journals, so
+// they cannot be read together, or entries would be shipped twice.
+func validateJournals(journals []string) error {
+	seen := make(map[string]bool)
+	for _, j := range journals {
+		if seen[j] {
+			return fmt.Errorf("duplicate journal %q", j)
+		}
+		seen[j] = true
+		switch {
+		case j == JournalLocal, j == JournalSystem:
+		case strings.HasPrefix(j, JournalUserPrefix):
+			if !userPattern.MatchString(strings.TrimPrefix(j, JournalUserPrefix)) {
+				return fmt.Errorf("invalid user in journal %q", j)
+			}
+		case strings.HasPrefix(j, JournalContainerPrefix):
+			id := strings.TrimPrefix(j, JournalContainerPrefix)
+			if id != AllContainers && !machineIDPattern.MatchString(id) {
+				return fmt.Errorf("invalid machine id in journal %q", j)
+			}
+		default:
+			return fmt.Errorf("invalid journal %q", j)
+		}
+	}
+	if !seen[JournalLocal] {
+		return nil
+	}
+	for _, j := range journals {
+		if j == JournalSystem || strings.HasPrefix(j, JournalUserPrefix) {
+			return fmt.Errorf("journal %q cannot be used with %q, which includes it", j, JournalLocal)
+		}
+	}
+	return nil
+}
@@ -3,7 +3,9 @@ package config
 import (
 	"fmt"
 	"os"
+	"regexp"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -33,22 +35,57 @@ func TestInitializeConfig_NoFile(t *testing.T) {
 	assert.Equal(t, DefaultLogGroup, c.LogGroup)
 	assert.Equal(t, dummyInstanceID, c.LogStream)
 	assert.Equal(t, DefaultStateFile, c.StateFile)
+	assert.Equal(t, DefaultMaxReadFailures, c.MaxReadFailures)
+	assert.Equal(t, StartPosition{Kind: StartHead}, c.Start)
+	assert.Equal(t, DefaultDataThreshold, c.DataThreshold)
+	assert.Equal(t, DefaultBinaryEncoding, c.BinaryEncoding)
+	assert.Equal(t, DefaultLagInterval, c.LagInterval)
+	assert.Equal(t, DefaultFormat, c.Format)
+	assert.Equal(t, DefaultFieldNames, c.FieldNames)
+	assert.Equal(t, DefaultTimestamp, c.Timestamp)
+	assert.Equal(t, DefaultMaxMessageSize, c.MaxMessageSize)
+	assert.Equal(t, DefaultRedactFields, c.RedactFields)
+	assert.Equal(t, DefaultDetectorAction, c.DetectorAction)
+	assert.Equal(t, DefaultParseMessageKey, c.ParseMessageKey)
+	assert.Equal(t, DefaultMultilineTimeout, c.MultilineTimeout)
+	assert.Equal(t, DefaultMultilineMaxLines, c.MultilineMaxLines)
+}
+
+// defaultConfig returns the config of an empty file.
+func defaultConfig() *Config {
+	return &Config{
+		LogGroup:          DefaultLogGroup,
+		LogStream:         dummyInstanceID,
+		StateFile:         DefaultStateFile,
+		MaxReadFailures:   DefaultMaxReadFailures,
+		StartPosition:     DefaultStartPosition,
+		Start:             StartPosition{Kind: StartHead},
+		DataThreshold:     DefaultDataThreshold,
+		BinaryEncoding:    DefaultBinaryEncoding,
+		MaxMessageSize:    DefaultMaxMessageSize,
+		Format:            DefaultFormat,
+		Timestamp:         DefaultTimestamp,
+		FieldNames:        DefaultFieldNames,
+		RedactFields:      DefaultRedactFields,
+		DetectorAction:    DefaultDetectorAction,
+		ParseMessageKey:   DefaultParseMessageKey,
+		LagInterval:       DefaultLagInterval,
+		MultilineTimeout:  DefaultMultilineTimeout,
+		MultilineMaxLines: DefaultMultilineMaxLines,
+	}
 }
 
 func TestInitializeConfig_FileOK(t *testing.T) {
 	cases := []struct {
-		name           string
-		fileContent    string
-		expectedConfig *Config
+		name        string
+		fileContent string
+		// expected changes the default config to the expected one.
+		expected func(c *Config)
 	}{
 		{
 			name:        "emepty file",
 			fileContent: "",
-			expectedConfig: &Config{
-				LogGroup:  DefaultLogGroup,
-				LogStream: dummyInstanceID,
-				StateFile: DefaultStateFile,
-			},
+			expected:    func(c *Config) {},
 		},
 		{
 			name: "with customized value",
@@ -56,11 +93,117 @@ func TestInitializeConfig_FileOK(t *testing.T) {
 				log_group = "log-group-1"
 				log_stream = "log-stream-1"
 				state_file = "/dir-1/state-file-1"
+				max_read_failures = 3
+				start_position = "since=24h"
+				data_threshold = 0
+				binary_encoding = "base64"
+				lag_interval = "1m"
+				format = "logfmt"
+				fields = "REQUEST_ID,CODE_LINE"
+				exclude_fields = "_HOSTNAME"
+				field_names = "camel"
+				timestamp = "source"
+				max_message_size = 1024
+				split_messages = true
+				detectors = "email,jwt"
+				detector_action = "hash"
+				detector_hash_key = "key-1"
+				parse_message = "json,logfmt"
+				parse_message_key = "body"
+				auth_events = true
+				multiline_start = '^\d{4}-'
+				multiline_units = "app.service"
+				multiline_timeout = "2s"
+				multiline_max_lines = 100
 				other_field = "other_value"`,
-			expectedConfig: &Config{
-				LogGroup:  "log-group-1",
-				LogStream: "log-stream-1",
-				StateFile: "/dir-1/state-file-1",
+			expected: func(c *Config) {
+				c.LogGroup = "log-group-1"
+				c.LogStream = "log-stream-1"
+				c.StateFile = "/dir-1/state-file-1"
+				c.MaxReadFailures = 3
+				c.StartPosition = "since=24h"
+				c.Start = StartPosition{Kind: StartSince, SinceDuration: 24 * time.Hour}
+				c.DataThreshold = 0
+				c.BinaryEncoding = "base64"
+				c.MaxMessageSize = 1024
+				c.SplitMessages = true
+				c.Format = "logfmt"
+				c.Timestamp = "source"
+				c.Fields = []string{"REQUEST_ID", "CODE_LINE"}
+				c.ExcludeFields = []string{"_HOSTNAME"}
+				c.FieldNames = "camel"
+				c.Detectors = []string{"email", "jwt"}
+				c.DetectorAction = "hash"
+				c.DetectorHashKey = "key-1"
+				c.ParseMessage = []string{"json", "logfmt"}
+				c.ParseMessageKey = "body"
+				c.AuthEvents = true
+				c.LagInterval = time.Minute
+				c.MultilineStart = `^\d{4}-`
+				c.MultilineStartPattern = regexp.MustCompile(`^\d{4}-`)
+				c.MultilineUnits = []string{"app.service"}
+				c.MultilineTimeout = 2 * time.Second
+				c.MultilineMaxLines = 100
+			},
+		},
+		{
+			name: "with matches",
+			fileContent: `
+				matches = "_SYSTEMD_UNIT=nginx.service PRIORITY=0..1 + _TRANSPORT=kernel"`,
+			expected: func(c *Config) {
+				c.Matches = "_SYSTEMD_UNIT=nginx.service PRIORITY=0..1 + _TRANSPORT=kernel"
+				c.MatchGroups = [][]string{
+					{"_SYSTEMD_UNIT=nginx.service", "PRIORITY=0", "PRIORITY=1"},
+					{"_TRANSPORT=kernel"},
+				}
+			},
+		},
+		{
+			name: "with journal directory",
+			fileContent: `
+				journal_directory = "/var/log/journal/remote"`,
+			expected: func(c *Config) {
+				// The log stream is left to the machine id of the journal files.
+				c.LogStream = ""
+				c.JournalDirectory = "/var/log/journal/remote"
+			},
+		},
+		{
+			name: "with journal files",
+			fileContent: `
+				log_stream = "log-stream-1"
+				journal_files = "/mnt/system.journal,/mnt/user-1000.journal"`,
+			expected: func(c *Config) {
+				c.LogStream = "log-stream-1"
+				c.JournalFiles = []string{"/mnt/system.journal", "/mnt/user-1000.journal"}
+			},
+		},
+		{
+			name: "with export file",
+			fileContent: `
+				export_file = "-"`,
+			expected: func(c *Config) {
+				// The log stream is left to the machine id of the first entry.
+				c.LogStream = ""
+				c.ExportFile = "-"
+			},
+		},
+		{
+			name: "with namespaces",
+			fileContent: `
+				namespaces = "foo,bar"`,
+			expected: func(c *Config) {
+				c.Namespaces = []string{"foo", "bar"}
+			},
+		},
+		{
+			name: "with journals",
+			fileContent: `
+				journals = "system,user:alice,user:1001,container:*,container:0123456789abcdef0123456789abcdef"`,
+			expected: func(c *Config) {
+				c.Journals = []string{
+					"system", "user:alice", "user:1001", "container:*", "container:0123456789abcdef0123456789abcdef",
+				}
 			},
 		},
 	}
@@ -74,7 +217,90 @@ func TestInitializeConfig_FileOK(t *testing.T) {
 			assert.NoError(t, err)
 			c, err := InitalizeConfig(dummyInstanceID, []string{f.Name()})
 			assert.NoError(t, err)
-			assert.Equal(t, *tc.expectedConfig, *c)
+			expected := defaultConfig()
+			tc.expected(expected)
+			assert.Equal(t, *expected, *c)
+		})
+	}
+}
+
+func TestInitializeConfig_Invalid(t *testing.T) {
+	cases := []struct {
+		name        string
+		fileContent string
+	}{
+		{"invalid matches", `matches = "_SYSTEMD_UNIT"`},
+		{"negative max read failures", `max_read_failures = -1`},
+		{"both journal directory and files", `
+			journal_directory = "/var/log/journal/remote"
+			journal_files = "/mnt/system.journal"`},
+		{"invalid namespace", `namespaces = "foo bar"`},
+		{"export file with journal files", `
+			export_file = "-"
+			journal_files = "/mnt/system.journal"`},
+		{"invalid start position", `start_position = "middle"`},
+		{"negative data threshold", `data_threshold = -1`},
+		{"invalid binary encoding", `binary_encoding = "base32"`},
+		{"negative max message size", `max_message_size = -1`},
+		{"split messages without max message size", `
+			max_message_size = 0
+			split_messages = true`},
+		{"invalid redact field", `redact_fields = "message"`},
+		{"invalid redaction rule", `redact_rule_token = 's/token=[/***/'`},
+		{"invalid detector", `detectors = "ssn"`},
+		{"invalid detector action", `detector_action = "drop"`},
+		{"hash without key", `
+			detectors = "*"
+			detector_action = "hash"`},
+		{"invalid parse message format", `parse_message = "xml"`},
+		{"parse message key of record", `parse_message_key = "message"`},
+		{"parse message key of audit", `parse_message_key = "audit"`},
+		{"invalid parse message key", `parse_message_key = "a.b"`},
+		{"invalid format", `format = "yaml"`},
+		{"invalid field", `fields = "request_id"`},
+		{"invalid excluded field", `exclude_fields = "*"`},
+		{"invalid field names", `field_names = "snake"`},
+		{"invalid timestamp", `timestamp = "now"`},
+		{"negative lag interval", `lag_interval = "-1m"`},
+		{"invalid multiline start", `multiline_start = '^(\d'`},
+		{"invalid multiline continue", `multiline_continue = '[\s'`},
+		{"zero multiline timeout", `multiline_timeout = "0s"`},
+		{"zero multiline max lines", `multiline_max_lines = 0`},
+		{"export file with tail", `
+			export_file = "/tmp/export"
+			start_position = "tail"`},
+		{"journal directory with current boot", `
+			journal_directory = "/var/log/journal/remote"
+			start_position = "current_boot"`},
+		{"container journals with current boot", `
+			journals = "local,container:*"
+			start_position = "current_boot"`},
+		{"export file with matches", `
+			export_file = "/tmp/export"
+			matches = "PRIORITY=3"`},
+		{"namespaces with journal directory", `
+			journal_directory = "/var/log/journal/remote"
+			namespaces = "*"`},
+		{"invalid journal", `journals = "remote"`},
+		{"invalid container machine id", `journals = "container:foo"`},
+		{"invalid user", `journals = "user:a b"`},
+		{"duplicate journal", `journals = "system,system"`},
+		{"local with user journal", `journals = "local,user:1000"`},
+		{"journals with export file", `
+			export_file = "-"
+			journals = "local"`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := os.CreateTemp("", "*.conf")
+			assert.NoError(t, err)
+			defer os.Remove(f.Name())
+			_, err = fmt.Fprintf(f, "%s\n", tc.fileContent)
+			assert.NoError(t, err)
+
+			_, err = InitalizeConfig(dummyInstanceID, []string{f.Name()})
+			assert.Error(t, err)
 		})
 	}
 }
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxMatchRange caps how many values a single range match like PRIORITY=0..7 expands to.
+const maxMatchRange = 64
+
+var (
+	// Field names are what sd_journal_add_match accepts: upper case letters, digits and underscores, not starting
+	// with a digit.
+	matchFieldPattern = regexp.MustCompile(`^[A-Z_][A-Z0-9_]{0,63}$`)
+
+	matchRangePattern = regexp.MustCompile(`^([0-9]+)\.\.([0-9]+)$`)
+)
+
+// ParseMatches parses a journalctl-style match expression into groups of "FIELD=value" matches. Matches within a
+// group are ANDed, except that matches on the same field are ORed, and groups separated by "+" are ORed, the same as
+// `journalctl _SYSTEMD_UNIT=nginx.service PRIORITY=3 + _SYSTEMD_UNIT=sshd.service`. A numeric range value such as
+// PRIORITY=0..4 expands to one match per value. An empty expression returns no groups, i.e. match everything.
+func ParseMatches(expr string) ([][]string, error) {
+	var groups [][]string
+	var group []string
+	for _, token := range strings.Fields(expr) {
+		if token == "+" {
+			if len(group) == 0 {
+				return nil, fmt.Errorf("invalid match expression %q, empty group around \"+\"", expr)
+			}
+			groups = append(groups, group)
+			group = nil
+			continue
+		}
+		matches, err := parseMatch(token)
+		if err != nil {
+			return nil, fmt.Errorf("invalid match expression %q, %w", expr, err)
+		}
+		group = append(group, matches...)
+	}
+	if len(group) == 0 {
+		if len(groups) > 0 {
+			return nil, fmt.Errorf("invalid match expression %q, empty group around \"+\"", expr)
+		}
+		return nil, nil
+	}
+	return append(groups, group), nil
+}
+
+// parseMatch parses a single FIELD=value token.
+func parseMatch(token string) ([]string, error) {
+	field, value, ok := strings.Cut(token, "=")
+	if !ok {
+		return nil, fmt.Errorf("match %q is not in the form FIELD=value", token)
+	}
+	if !matchFieldPattern.MatchString(field) {
+		return nil, fmt.Errorf("match %q has an invalid field name", token)
+	}
+	m := matchRangePattern.FindStringSubmatch(value)
+	if m == nil {
+		return []string{token}, nil
+	}
+	from, err1 := strconv.Atoi(m[1])
+	to, err2 := strconv.Atoi(m[2])
+	if err1 != nil || err2 != nil || from > to {
+		return nil, fmt.Errorf("match %q has an invalid range", token)
+	}
+	if to-from >= maxMatchRange {
+		return nil, fmt.Errorf("match %q has a range of more than %d values", token, maxMatchRange)
+	}
+	matches := make([]string, 0, to-from+1)
+	for i := from; i <= to; i++ {
+		matches = append(matches, fmt.Sprintf("%s=%d", field, i))
+	}
+	return matches, nil
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMatches(t *testing.T) {
+	cases := []struct {
+		name           string
+		expr           string
+		expectedGroups [][]string
+	}{
+		{"empty expression", "", nil},
+		{"blank expression", "  ", nil},
+		{"single match", "_SYSTEMD_UNIT=nginx.service", [][]string{{"_SYSTEMD_UNIT=nginx.service"}}},
+		{
+			"and group",
+			"_SYSTEMD_UNIT=nginx.service PRIORITY=3",
+			[][]string{{"_SYSTEMD_UNIT=nginx.service", "PRIORITY=3"}},
+		},
+		{
+			"or groups",
+			"_SYSTEMD_UNIT=nginx.service + _SYSTEMD_UNIT=sshd.service",
+			[][]string{{"_SYSTEMD_UNIT=nginx.service"}, {"_SYSTEMD_UNIT=sshd.service"}},
+		},
+		{
+			"range",
+			"PRIORITY=0..2 _TRANSPORT=kernel",
+			[][]string{{"PRIORITY=0", "PRIORITY=1", "PRIORITY=2", "_TRANSPORT=kernel"}},
+		},
+		{"empty value", "MESSAGE_ID=", [][]string{{"MESSAGE_ID="}}},
+		{"value with equal sign", "MESSAGE=a=b", [][]string{{"MESSAGE=a=b"}}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			groups, err := ParseMatches(tc.expr)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedGroups, groups)
+		})
+	}
+}
+
+func TestParseMatches_Invalid(t *testing.T) {
+	cases := []struct {
+		name string
+		expr string
+	}{
+		{"missing equal sign", "_SYSTEMD_UNIT"},
+		{"lower case field", "_systemd_unit=nginx.service"},
+		{"field starts with digit", "1FIELD=1"},
+		{"empty field", "=nginx.service"},
+		{"leading plus", "+ PRIORITY=3"},
+		{"trailing plus", "PRIORITY=3 +"},
+		{"double plus", "PRIORITY=3 + + PRIORITY=4"},
+		{"reversed range", "PRIORITY=4..0"},
+		{"range too big", "PRIORITY=0..1000"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseMatches(tc.expr)
+			assert.Error(t, err)
+		})
+	}
+}
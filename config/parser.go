@@ -0,0 +1,64 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"snappydevtools.com/journald-to-cwl/batch"
+)
+
+// ParserPrefix starts the keys of parsers in the config file, e.g. "parser_web".
+const ParserPrefix = "parser_"
+
+// ParserRule binds a parser expression to the entries of a systemd unit or a syslog identifier.
+type ParserRule struct {
+	// Name is the config key without ParserPrefix.
+	Name string
+
+	// Either Unit or Identifier is set.
+	Unit       string
+	Identifier string
+
+	// Expr is the name of a built-in parser or a regex with named submatches and grok references. It is compiled by
+	// batch.NewParser.
+	Expr string
+}
+
+// ParseParserRule parses a parser in the form of "unit=<unit> <expr>" or "ident=<syslog identifier> <expr>".
+func ParseParserRule(name, expr string) (ParserRule, error) {
+	r := ParserRule{Name: name}
+	var err error
+	if r.Unit, r.Identifier, r.Expr, err = cutScope(expr, "parser "+name); err != nil {
+		return ParserRule{}, err
+	}
+	if r.Expr == "" {
+		return ParserRule{}, fmt.Errorf("empty parser %s, want unit=<unit> or ident=<identifier> followed by a "+
+			"parser", name)
+	}
+	return r, nil
+}
+
+// parseParserRules parses and compiles the settings whose keys start with ParserPrefix, in the order of their keys.
+func parseParserRules(settings map[string]string) ([]batch.Parser, error) {
+	var keys []string
+	for k := range settings {
+		if strings.HasPrefix(k, ParserPrefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var parsers []batch.Parser
+	for _, k := range keys {
+		r, err := ParseParserRule(strings.TrimPrefix(k, ParserPrefix), settings[k])
+		if err != nil {
+			return nil, err
+		}
+		p, err := batch.NewParser(r.Name, r.Unit, r.Identifier, r.Expr)
+		if err != nil {
+			return nil, err
+		}
+		parsers = append(parsers, p)
+	}
+	return parsers, nil
+}
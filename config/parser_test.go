@@ -0,0 +1,67 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseParserRule(t *testing.T) {
+	r, err := ParseParserRule("web", "unit=nginx.service nginx")
+	assert.NoError(t, err)
+	assert.Equal(t, ParserRule{Name: "web", Unit: "nginx.service", Expr: "nginx"}, r)
+
+	r, err = ParseParserRule("app", `ident=app ^%{WORD:level} (?P<text>.*)$`)
+	assert.NoError(t, err)
+	assert.Equal(t, ParserRule{Name: "app", Identifier: "app", Expr: `^%{WORD:level} (?P<text>.*)$`}, r)
+}
+
+func TestParseParserRule_Invalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"nginx",
+		"unit=nginx.service",
+		"unit= nginx",
+		"host=foo nginx",
+	} {
+		_, err := ParseParserRule("name", expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestInitializeConfig_Parsers(t *testing.T) {
+	f, err := os.CreateTemp("", "*.conf")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = fmt.Fprint(f, `
+		parser_sshd = 'ident=sshd sshd'
+		parser_nginx = 'unit=nginx.service nginx'
+	`)
+	assert.NoError(t, err)
+
+	c, err := InitalizeConfig(dummyInstanceID, []string{f.Name()})
+	assert.NoError(t, err)
+	// Parsers are in the order of their names, and compiled.
+	assert.Len(t, c.Parsers, 2)
+	assert.Equal(t, "nginx", c.Parsers[0].Name)
+	assert.Equal(t, "nginx.service", c.Parsers[0].Unit)
+	assert.NotNil(t, c.Parsers[0].Pattern)
+	assert.Equal(t, "sshd", c.Parsers[1].Name)
+	assert.Equal(t, "sshd", c.Parsers[1].Identifier)
+	assert.NotNil(t, c.Parsers[1].Pattern)
+}
+
+func TestInitializeConfig_InvalidParser(t *testing.T) {
+	f, err := os.CreateTemp("", "*.conf")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = fmt.Fprint(f, `
+		parser_app = 'ident=app ^%{NOSUCHPATTERN:level}$'
+	`)
+	assert.NoError(t, err)
+
+	_, err = InitalizeConfig(dummyInstanceID, []string{f.Name()})
+	assert.Error(t, err)
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// RedactionRulePrefix starts the keys of redaction rules in the config file, e.g. "redact_rule_token".
+const RedactionRulePrefix = "redact_rule_"
+
+// DefaultRedactFields are the journal fields that redaction rules apply to by default.
+var DefaultRedactFields = []string{"MESSAGE"}
+
+// RedactionRule replaces the matches of Pattern with Replacement in journal fields.
+type RedactionRule struct {
+	// Name is the config key without RedactionRulePrefix.
+	Name string
+
+	// The rule only applies to entries of the systemd unit or the syslog identifier, if it is set.
+	Unit       string
+	Identifier string
+
+	Pattern *regexp.Regexp
+
+	// Replacement can refer to submatches of Pattern, like regexp.Regexp.Expand, e.g. "${1}***".
+	Replacement string
+}
+
+// ParseRedactionRule parses a rule in the form of a sed substitution, "s/<regex>/<replacement>/", optionally preceded
+// by "unit=<unit> " or "ident=<syslog identifier> " to scope the rule. Any character after "s" is the delimiter, so
+// "s|a/b|c|" replaces "a/b". The regex is in the RE2 syntax, see https://golang.org/s/re2syntax.
+func ParseRedactionRule(name, expr string) (RedactionRule, error) {
+	r := RedactionRule{Name: name}
+	expr = strings.TrimSpace(expr)
+	// The regex can have spaces, so only a first word that is a scope is one.
+	if strings.HasPrefix(expr, "unit=") || strings.HasPrefix(expr, "ident=") {
+		var err error
+		if r.Unit, r.Identifier, expr, err = cutScope(expr, "redaction rule "+name); err != nil {
+			return RedactionRule{}, err
+		}
+	}
+
+	if len(expr) < 2 || expr[0] != 's' {
+		return RedactionRule{}, fmt.Errorf("invalid redaction rule %s %q, want s/<regex>/<replacement>/", name, expr)
+	}
+	delimiter := expr[1:2]
+	parts := strings.Split(expr[2:], delimiter)
+	if len(parts) != 3 || parts[2] != "" {
+		return RedactionRule{}, fmt.Errorf("invalid redaction rule %s %q, want s%s<regex>%s<replacement>%s", name, expr,
+			delimiter, delimiter, delimiter)
+	}
+	if parts[0] == "" {
+		return RedactionRule{}, fmt.Errorf("empty regex in redaction rule %s", name)
+	}
+	pattern, err := regexp.Compile(parts[0])
+	if err != nil {
+		return RedactionRule{}, fmt.Errorf("invalid regex in redaction rule %s, %w", name, err)
+	}
+	r.Pattern = pattern
+	r.Replacement = parts[1]
+	return r, nil
+}
+
+// cutScope cuts "unit=<unit> " or "ident=<syslog identifier> " off the start of the expression of the rule, and returns
+// the unit or the identifier and the rest of the expression.
+func cutScope(expr string, rule string) (string, string, string, error) {
+	scope, rest, _ := strings.Cut(strings.TrimSpace(expr), " ")
+	key, value, _ := strings.Cut(scope, "=")
+	if key != "unit" && key != "ident" {
+		return "", "", "", fmt.Errorf("invalid scope %q of %s, want unit=<unit> or ident=<identifier>", scope, rule)
+	}
+	if value == "" {
+		return "", "", "", fmt.Errorf("empty scope %q of %s", scope, rule)
+	}
+	if key == "unit" {
+		return value, "", strings.TrimSpace(rest), nil
+	}
+	return "", value, strings.TrimSpace(rest), nil
+}
+
+// parseRedactionRules parses the settings whose keys start with RedactionRulePrefix, in the order of their keys.
+func parseRedactionRules(settings map[string]string) ([]RedactionRule, error) {
+	var keys []string
+	for k := range settings {
+		if strings.HasPrefix(k, RedactionRulePrefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var rules []RedactionRule
+	for _, k := range keys {
+		r, err := ParseRedactionRule(strings.TrimPrefix(k, RedactionRulePrefix), settings[k])
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
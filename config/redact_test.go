@@ -0,0 +1,75 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRedactionRule(t *testing.T) {
+	cases := []struct {
+		expr               string
+		expectedUnit       string
+		expectedIdentifier string
+		expectedPattern    string
+		expectedReplace    string
+	}{
+		{`s/token=\S+/token=***/`, "", "", `token=\S+`, "token=***"},
+		{`s|https://[^@]+@|https://***@|`, "", "", `https://[^@]+@`, "https://***@"},
+		{`unit=app.service s/(password=)\S+/${1}***/`, "app.service", "", `(password=)\S+`, "${1}***"},
+		{`ident=sudo s/secret//`, "", "sudo", "secret", ""},
+		{`s/password: \S+/password: ***/`, "", "", `password: \S+`, "password: ***"},
+		{`unit=app.service s/api key \S+/api key ***/`, "app.service", "", `api key \S+`, "api key ***"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			r, err := ParseRedactionRule("name", tc.expr)
+			assert.NoError(t, err)
+			assert.Equal(t, "name", r.Name)
+			assert.Equal(t, tc.expectedUnit, r.Unit)
+			assert.Equal(t, tc.expectedIdentifier, r.Identifier)
+			assert.Equal(t, tc.expectedPattern, r.Pattern.String())
+			assert.Equal(t, tc.expectedReplace, r.Replacement)
+		})
+	}
+}
+
+func TestParseRedactionRule_Invalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"token",
+		"s/token/",
+		"s/token/***/extra/",
+		"s//***/",
+		"s/token=[/***/",
+		"host=foo s/token/***/",
+		"unit= s/token/***/",
+	} {
+		_, err := ParseRedactionRule("name", expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestInitializeConfig_RedactionRules(t *testing.T) {
+	f, err := os.CreateTemp("", "*.conf")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = fmt.Fprint(f, `
+		redact_rule_2_password = 's/(password=)\S+/${1}***/'
+		redact_rule_1_token = 'unit=app.service s/token=\S+/token=***/'
+		redact_fields = "MESSAGE,_CMDLINE"
+	`)
+	assert.NoError(t, err)
+
+	c, err := InitalizeConfig(dummyInstanceID, []string{f.Name()})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"MESSAGE", "_CMDLINE"}, c.RedactFields)
+	assert.Len(t, c.RedactionRules, 2)
+	// Rules are in the order of their names.
+	assert.Equal(t, "1_token", c.RedactionRules[0].Name)
+	assert.Equal(t, "app.service", c.RedactionRules[0].Unit)
+	assert.Equal(t, "2_password", c.RedactionRules[1].Name)
+	assert.Equal(t, "${1}***", c.RedactionRules[1].Replacement)
+}
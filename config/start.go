@@ -0,0 +1,71 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Kinds of StartPosition.
+const (
+	// StartHead starts with the oldest entry.
+	StartHead = "head"
+
+	// StartTail starts with the first entry written after start.
+	StartTail = "tail"
+
+	// StartSince starts with the first entry at or after a time.
+	StartSince = "since"
+
+	// StartCurrentBoot starts with the first entry of the current boot.
+	StartCurrentBoot = "current_boot"
+)
+
+// DefaultStartPosition keeps the existing behavior of reading the whole journal.
+const DefaultStartPosition = StartHead
+
+// StartPosition is where to start reading the journal when there is no cursor, or the cursor cannot be sought to.
+type StartPosition struct {
+	Kind string
+
+	// For StartSince, either SinceTime or SinceDuration before now is set.
+	SinceTime     time.Time
+	SinceDuration time.Duration
+}
+
+// Since returns the time to start with for StartSince.
+func (p StartPosition) Since(now time.Time) time.Time {
+	if !p.SinceTime.IsZero() {
+		return p.SinceTime
+	}
+	return now.Add(-p.SinceDuration)
+}
+
+// sinceLayouts are accepted time layouts of "since=<timestamp>". Timestamps without time zone are in UTC.
+var sinceLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"}
+
+// ParseStartPosition parses one of "head", "tail", "current_boot", "since=<duration>" such as "since=24h", or
+// "since=<timestamp>" such as "since=2024-10-01T00:00:00Z".
+func ParseStartPosition(v string) (StartPosition, error) {
+	switch v {
+	case StartHead, StartTail, StartCurrentBoot:
+		return StartPosition{Kind: v}, nil
+	}
+	since, ok := strings.CutPrefix(v, StartSince+"=")
+	if !ok {
+		return StartPosition{}, fmt.Errorf("invalid start position %q, must be one of head, tail, current_boot, "+
+			"since=<duration or timestamp>", v)
+	}
+	if d, err := time.ParseDuration(since); err == nil {
+		if d < 0 {
+			return StartPosition{}, fmt.Errorf("invalid start position %q, negative duration", v)
+		}
+		return StartPosition{Kind: StartSince, SinceDuration: d}, nil
+	}
+	for _, layout := range sinceLayouts {
+		if t, err := time.Parse(layout, since); err == nil {
+			return StartPosition{Kind: StartSince, SinceTime: t}, nil
+		}
+	}
+	return StartPosition{}, fmt.Errorf("invalid start position %q, cannot parse duration or timestamp", v)
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseStartPosition(t *testing.T) {
+	cases := []struct {
+		value    string
+		expected StartPosition
+	}{
+		{"head", StartPosition{Kind: StartHead}},
+		{"tail", StartPosition{Kind: StartTail}},
+		{"current_boot", StartPosition{Kind: StartCurrentBoot}},
+		{"since=24h", StartPosition{Kind: StartSince, SinceDuration: 24 * time.Hour}},
+		{"since=2024-10-01T08:00:00-07:00", StartPosition{Kind: StartSince,
+			SinceTime: time.Date(2024, 10, 1, 8, 0, 0, 0, time.FixedZone("", -7*60*60))}},
+		{"since=2024-10-01 08:00:00", StartPosition{Kind: StartSince,
+			SinceTime: time.Date(2024, 10, 1, 8, 0, 0, 0, time.UTC)}},
+		{"since=2024-10-01", StartPosition{Kind: StartSince, SinceTime: time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC)}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.value, func(t *testing.T) {
+			p, err := ParseStartPosition(tc.value)
+			assert.NoError(t, err)
+			assert.True(t, tc.expected.SinceTime.Equal(p.SinceTime))
+			tc.expected.SinceTime = p.SinceTime
+			assert.Equal(t, tc.expected, p)
+		})
+	}
+}
+
+func TestParseStartPosition_Invalid(t *testing.T) {
+	for _, v := range []string{"", "HEAD", "since", "since=", "since=-1h", "since=yesterday", "since=2024-13-01"} {
+		_, err := ParseStartPosition(v)
+		assert.Error(t, err, v)
+	}
+}
+
+func TestStartPositionSince(t *testing.T) {
+	now := time.Date(2024, 10, 2, 0, 0, 0, 0, time.UTC)
+	p := StartPosition{Kind: StartSince, SinceDuration: time.Hour}
+	assert.Equal(t, now.Add(-time.Hour), p.Since(now))
+	p = StartPosition{Kind: StartSince, SinceTime: time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC)}
+	assert.Equal(t, p.SinceTime, p.Since(now))
+}
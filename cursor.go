@@ -1,54 +1,190 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 )
 
+var errNoCursor = errors.New("no cursor")
+
 // Cursor stores and retrieve the cursor, a string that uniquely describes the position of an entry in the journal.
 type Cursor interface {
 	Get() (string, error)
 	Set(string) error
 }
 
-// FilebasedCursor stores the cursor in a file.
+// FilebasedCursor stores the cursor in a file. It keeps one cursor per source, e.g. a journal namespace, one per line
+// as "<source> <cursor>". The cursor of the default source is a line of the cursor only, so the file stays compatible
+// with the single cursor format. The file is replaced as a whole on every write, so a crash never leaves it partly
+// written.
 type FilebasedCursor struct {
-	file *os.File
+	fileName string
+
+	// mu guards the file, which is shared by the cursors of all sources.
+	mu sync.Mutex
 }
 
 func NewFilebasedCursor(fileName string) (*FilebasedCursor, error) {
+	// Fail early if the file cannot be created.
 	f, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE, 0600)
 	if err != nil {
 		return nil, err
 	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
 
 	return &FilebasedCursor{
-		file: f,
+		fileName: fileName,
 	}, nil
 }
 
+// Get returns the cursor of the default source.
 func (c *FilebasedCursor) Get() (string, error) {
-	var cursor string
-	_, err := c.file.Seek(0, 0)
+	return c.get("")
+}
+
+// Set saves the cursor of the default source.
+func (c *FilebasedCursor) Set(v string) error {
+	return c.set("", v)
+}
+
+// ForSource returns a Cursor that stores the cursor of the given source in the same file. Setting an empty cursor
+// removes it.
+func (c *FilebasedCursor) ForSource(source string) Cursor {
+	return &sourceCursor{file: c, source: source}
+}
+
+// Close does nothing, since the file is only open while it is read or written. It is kept so callers do not depend on
+// that.
+func (c *FilebasedCursor) Close() error {
+	return nil
+}
+
+func (c *FilebasedCursor) get(source string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cursors, err := c.read()
 	if err != nil {
 		return "", err
 	}
-	if _, err := fmt.Fscanf(c.file, "%s", &cursor); err != nil {
-		return "", err
+	cursor, ok := cursors[source]
+	if !ok {
+		return "", errNoCursor
 	}
 	return cursor, nil
 }
 
-func (c *FilebasedCursor) Set(v string) error {
-	if _, err := c.file.Seek(0, 0); err != nil {
+func (c *FilebasedCursor) set(source, v string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cursors, err := c.read()
+	if err != nil {
+		return err
+	}
+	if v == "" {
+		delete(cursors, source)
+	} else {
+		cursors[source] = v
+	}
+	return c.write(cursors)
+}
+
+// read reads cursors of all sources from the file.
+func (c *FilebasedCursor) read() (map[string]string, error) {
+	content, err := os.ReadFile(c.fileName)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	cursors := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		switch len(fields) {
+		case 1:
+			cursors[""] = fields[0]
+		case 2:
+			cursors[fields[0]] = fields[1]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return cursors, nil
+}
+
+// write replaces the file with cursors of all sources. The cursors are written to a temporary file in the same
+// directory, which is synced and renamed over the file, so the file has either the old or the new cursors of all
+// sources if journald-to-cwl or the host crashes while writing.
+func (c *FilebasedCursor) write(cursors map[string]string) error {
+	sources := make([]string, 0, len(cursors))
+	for source := range cursors {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	var sb strings.Builder
+	for _, source := range sources {
+		if source == "" {
+			fmt.Fprintf(&sb, "%s\n", cursors[source])
+			continue
+		}
+		fmt.Fprintf(&sb, "%s %s\n", source, cursors[source])
+	}
+
+	dir := filepath.Dir(c.fileName)
+	tmp, err := os.CreateTemp(dir, filepath.Base(c.fileName)+".tmp-*")
+	if err != nil {
 		return err
 	}
-	if _, err := fmt.Fprintf(c.file, "%s", v); err != nil {
+	defer func() {
+		// Removing fails once the file is renamed.
+		_ = os.Remove(tmp.Name())
+	}()
+	if _, err := tmp.WriteString(sb.String()); err != nil {
+		tmp.Close()
 		return err
 	}
-	return nil
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), c.fileName); err != nil {
+		return err
+	}
+	return syncDir(dir)
 }
 
-func (c *FilebasedCursor) Close() error {
-	return c.file.Close()
+// syncDir syncs the directory, so a file renamed in it persists.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// sourceCursor is the Cursor of one source in a FilebasedCursor.
+type sourceCursor struct {
+	file   *FilebasedCursor
+	source string
+}
+
+func (c *sourceCursor) Get() (string, error) {
+	return c.file.get(c.source)
+}
+
+func (c *sourceCursor) Set(v string) error {
+	return c.file.set(c.source, v)
 }
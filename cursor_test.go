@@ -2,6 +2,7 @@ package main
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -26,3 +27,63 @@ func TestCursor(t *testing.T) {
 	v, _ = cursor.Get()
 	assert.Equal(t, "cursor-0", v)
 }
+
+func TestCursorPerSource(t *testing.T) {
+	f, err := os.CreateTemp("", "cursor-*")
+	assert.NoError(t, err)
+	defer func() {
+		f.Close()
+		os.Remove(f.Name())
+	}()
+	// A state file written with the single cursor format.
+	_, err = f.WriteString("cursor-0")
+	assert.NoError(t, err)
+
+	cursor, err := NewFilebasedCursor(f.Name())
+	assert.NoError(t, err)
+	v, err := cursor.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, "cursor-0", v)
+
+	foo := cursor.ForSource("foo")
+	_, err = foo.Get()
+	assert.Error(t, err)
+	assert.NoError(t, foo.Set("foo-cursor-0"))
+	assert.NoError(t, cursor.Set("cursor-10"))
+	assert.NoError(t, foo.Set("foo-cursor-1"))
+
+	v, _ = cursor.Get()
+	assert.Equal(t, "cursor-10", v)
+	v, _ = foo.Get()
+	assert.Equal(t, "foo-cursor-1", v)
+
+	content, err := os.ReadFile(f.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, "cursor-10\nfoo foo-cursor-1\n", string(content))
+
+	assert.NoError(t, foo.Set(""))
+	_, err = foo.Get()
+	assert.Error(t, err)
+}
+
+// TestCursorReplacesFile tests that the state file is replaced as a whole, and no temporary file is left behind.
+func TestCursorReplacesFile(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "state")
+
+	cursor, err := NewFilebasedCursor(name)
+	assert.NoError(t, err)
+	assert.NoError(t, cursor.Set("cursor-0"))
+	assert.NoError(t, cursor.ForSource("foo").Set("foo-cursor-0"))
+	assert.NoError(t, cursor.Set("cursor-1"))
+
+	content, err := os.ReadFile(name)
+	assert.NoError(t, err)
+	assert.Equal(t, "cursor-1\nfoo foo-cursor-0\n", string(content))
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	info, err := os.Stat(name)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
@@ -0,0 +1,115 @@
+package cwl
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+
+	"snappydevtools.com/journald-to-cwl/batch"
+)
+
+// maxAcknowledgedPages caps GetLogEvents calls to verify one batch. Events of the same millisecond rarely fill a page.
+const maxAcknowledgedPages = 10
+
+// InFlight marks a batch that is being written to CWL. If journald-to-cwl stops before the batch is acknowledged, the
+// marker tells which batch to look for in CWL on restart, so the batch is neither lost nor sent twice.
+type InFlight struct {
+	// Cursor of the last journal entry in the batch.
+	Cursor string
+
+	// Timestamp of the last log event in the batch, in milliseconds.
+	Timestamp int64
+
+	// Digest of the message of the last log event in the batch.
+	Digest string
+
+	// EntryID is the id of the entry of the last log event in the batch, which is in its message, see
+	// batch.Record.EntryID. Log events of different entries can have the same message and timestamp, but not the same
+	// entry id. It is "" if the message does not have it, e.g. in batch.FormatShort, in which case the log event is
+	// found by its timestamp and digest only.
+	EntryID string
+}
+
+// NewInFlight returns the marker of a batch.
+func NewInFlight(b *batch.Batch) InFlight {
+	last := b.Events[len(b.Events)-1]
+	return InFlight{
+		Cursor:    b.Cursor,
+		Timestamp: aws.ToInt64(last.Timestamp),
+		Digest:    digest(aws.ToString(last.Message)),
+		EntryID:   b.EntryID,
+	}
+}
+
+// ParseInFlight parses a marker formatted by InFlight.String.
+func ParseInFlight(v string) (InFlight, error) {
+	parts := strings.SplitN(v, ",", 4)
+	if len(parts) != 4 {
+		return InFlight{}, fmt.Errorf("invalid in-flight marker %q", v)
+	}
+	ts, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return InFlight{}, fmt.Errorf("invalid in-flight marker %q, %w", v, err)
+	}
+	return InFlight{Cursor: parts[3], Timestamp: ts, Digest: parts[1], EntryID: parts[2]}, nil
+}
+
+// String formats the marker as "<timestamp>,<digest>,<entry id>,<cursor>". It has no white space, so it can be saved
+// like a cursor.
+func (f InFlight) String() string {
+	return fmt.Sprintf("%d,%s,%s,%s", f.Timestamp, f.Digest, f.EntryID, f.Cursor)
+}
+
+// Acknowledged tells whether the last log event of the in-flight batch is in the log stream, by its timestamp, the
+// digest of its message and the entry id in its message, if any. PutLogEvents writes a batch as a whole, so the last
+// event being there means the whole batch is.
+func Acknowledged(
+	ctx context.Context,
+	cwlClient CloudwatchLogsAPI,
+	logGroup string,
+	logStream string,
+	f InFlight,
+) (bool, error) {
+	request := &cloudwatchlogs.GetLogEventsInput{
+		LogGroupName:  aws.String(logGroup),
+		LogStreamName: aws.String(logStream),
+		StartTime:     aws.Int64(f.Timestamp),
+		EndTime:       aws.Int64(f.Timestamp + 1),
+		StartFromHead: aws.Bool(true),
+	}
+	for i := 0; i < maxAcknowledgedPages; i++ {
+		output, err := cwlClient.GetLogEvents(ctx, request)
+		var notFound *types.ResourceNotFoundException
+		if errors.As(err, &notFound) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		for _, event := range output.Events {
+			message := aws.ToString(event.Message)
+			if digest(message) == f.Digest && (f.EntryID == "" || strings.Contains(message, f.EntryID)) {
+				return true, nil
+			}
+		}
+		// GetLogEvents returns the same token at the end of the stream.
+		if output.NextForwardToken == nil || aws.ToString(output.NextForwardToken) == aws.ToString(request.NextToken) {
+			return false, nil
+		}
+		request.NextToken = output.NextForwardToken
+	}
+	return false, fmt.Errorf("cannot find log event of in-flight batch in %d pages", maxAcknowledgedPages)
+}
+
+func digest(message string) string {
+	sum := sha256.Sum256([]byte(message))
+	return hex.EncodeToString(sum[:16])
+}
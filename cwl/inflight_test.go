@@ -0,0 +1,194 @@
+package cwl
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/stretchr/testify/assert"
+
+	"snappydevtools.com/journald-to-cwl/batch"
+)
+
+func TestInFlight(t *testing.T) {
+	b := &batch.Batch{
+		Events: []types.InputLogEvent{
+			{Message: aws.String("message-0"), Timestamp: aws.Int64(1722650790111)},
+			{Message: aws.String("message-1"), Timestamp: aws.Int64(1722650790112)},
+		},
+		Cursor:  "s=a;i=2;b=b;m=2;t=2;x=0",
+		EntryID: "0123456789abcdef",
+	}
+	f := NewInFlight(b)
+	assert.Equal(t, "s=a;i=2;b=b;m=2;t=2;x=0", f.Cursor)
+	assert.Equal(t, int64(1722650790112), f.Timestamp)
+	assert.Equal(t, digest("message-1"), f.Digest)
+	assert.Equal(t, "0123456789abcdef", f.EntryID)
+
+	parsed, err := ParseInFlight(f.String())
+	assert.NoError(t, err)
+	assert.Equal(t, f, parsed)
+
+	_, err = ParseInFlight("cursor-0")
+	assert.Error(t, err)
+}
+
+func TestAcknowledged(t *testing.T) {
+	message := `{"entryId":"0123456789abcdef","message":"connection lost"}`
+	f := InFlight{Cursor: "cursor-1", Timestamp: 1722650790112, Digest: digest(message), EntryID: "0123456789abcdef"}
+	cases := []struct {
+		name          string
+		stub          *cwlStub
+		expected      bool
+		expectedError bool
+	}{
+		{"no events", &cwlStub{}, false, false},
+		{
+			"found in the second page",
+			&cwlStub{pages: [][]types.OutputLogEvent{
+				{{Message: aws.String("message-0")}},
+				{{Message: aws.String("other")}, {Message: aws.String(message)}},
+			}},
+			true,
+			false,
+		},
+
+		{
+			"not found",
+			&cwlStub{pages: [][]types.OutputLogEvent{{{Message: aws.String("message-0")}}}},
+			false,
+			false,
+		},
+		{
+			"log stream does not exist",
+			&cwlStub{errOnGetEvents: &types.ResourceNotFoundException{Message: aws.String("stream does not exist")}},
+			false,
+			false,
+		},
+		{"get log events failed", &cwlStub{errOnGetEvents: errors.New("access denied")}, false, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ok, err := Acknowledged(context.Background(), tc.stub, "journal-logs", "i-11111111111111111", f)
+			if tc.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, ok)
+		})
+	}
+
+	// The message of another entry with the same digest is not the last log event of the batch.
+	other := f
+	other.EntryID = "fedcba9876543210"
+	stub := &cwlStub{pages: [][]types.OutputLogEvent{{{Message: aws.String(message)}}}}
+	ok, err := Acknowledged(context.Background(), stub, "journal-logs", "i-11111111111111111", other)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// A log event without an entry id, e.g. in the short format, is found by its timestamp and message.
+	short := "sshd[1]: connection lost"
+	f = InFlight{Cursor: "cursor-1", Timestamp: 1722650790112, Digest: digest(short)}
+	parsed, err := ParseInFlight(f.String())
+	assert.NoError(t, err)
+	assert.Equal(t, f, parsed)
+	stub = &cwlStub{pages: [][]types.OutputLogEvent{{{Message: aws.String(short)}}}}
+	ok, err = Acknowledged(context.Background(), stub, "journal-logs", "i-11111111111111111", f)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestWriteMarksInFlight(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b := &batch.Batch{
+		Events: []types.InputLogEvent{{Message: aws.String("message-0"), Timestamp: aws.Int64(1722650790111)}},
+		Cursor: "cursor-0",
+	}
+	batches := make(chan *batch.Batch)
+	go func() {
+		defer cancel()
+		batches <- b
+	}()
+
+	var saved []string
+	w := NewWriter(batches, &cwlStub{}, "journal-logs", "i-11111111111111111",
+		func(cursor string) error {
+			saved = append(saved, "cursor "+cursor)
+			return nil
+		},
+		WithSaveInFlight(func(marker string) error {
+			saved = append(saved, "in-flight "+marker)
+			return nil
+		}))
+	w.Write(ctx)
+
+	assert.Equal(t, []string{"in-flight " + NewInFlight(b).String(), "cursor cursor-0", "in-flight "}, saved)
+}
+
+func TestWriteSkipsAcknowledgedBatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b := &batch.Batch{
+		Events: []types.InputLogEvent{{Message: aws.String("message-0"), Timestamp: aws.Int64(1722650790111)}},
+		Cursor: "cursor-0",
+	}
+	batches := make(chan *batch.Batch)
+	go func() {
+		defer cancel()
+		batches <- b
+	}()
+
+	// PutLogEvents times out after CWL has taken the batch.
+	s := &cwlStub{
+		errOnPutLogEventsOnce: errors.New("request timeout"),
+		pages:                 [][]types.OutputLogEvent{{{Message: aws.String("message-0")}}},
+	}
+	var cursors []string
+	w := NewWriter(batches, s, "journal-logs", "i-11111111111111111",
+		func(cursor string) error {
+			cursors = append(cursors, cursor)
+			return nil
+		},
+		WithSaveInFlight(func(string) error { return nil }))
+	w.Write(ctx)
+
+	assert.Equal(t, 0, s.eventsCnt)
+	assert.Equal(t, []string{"cursor-0"}, cursors)
+}
+
+func TestWriteStopsWhenCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b := &batch.Batch{
+		Events: []types.InputLogEvent{{Message: aws.String("message-0"), Timestamp: aws.Int64(1722650790111)}},
+		Cursor: "cursor-0",
+	}
+	batches := make(chan *batch.Batch, 1)
+	batches <- b
+
+	// journald-to-cwl stops while the batch is written.
+	s := &cwlStub{errOnPutLogEvents: context.Canceled, errOnGetEvents: context.Canceled}
+	var saved []string
+	w := NewWriter(batches, s, "journal-logs", "i-11111111111111111",
+		func(cursor string) error {
+			saved = append(saved, "cursor "+cursor)
+			return nil
+		},
+		WithSaveInFlight(func(marker string) error {
+			saved = append(saved, "in-flight "+marker)
+			cancel()
+			return nil
+		}))
+	assert.NotPanics(t, func() { w.Write(ctx) })
+
+	// The in-flight marker is kept for the restart.
+	assert.Equal(t, []string{"in-flight " + NewInFlight(b).String()}, saved)
+}
@@ -29,10 +29,16 @@ type CloudwatchLogsAPI interface {
 
 	CreateLogStream(ctx context.Context, params *cloudwatchlogs.CreateLogStreamInput,
 		optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.CreateLogStreamOutput, error)
+
+	GetLogEvents(ctx context.Context, params *cloudwatchlogs.GetLogEventsInput,
+		optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.GetLogEventsOutput, error)
 }
 
 type SaveCursor func(cursor string) error
 
+// SaveInFlight saves the in-flight marker, see InFlight. An empty marker clears it.
+type SaveInFlight func(marker string) error
+
 // Writer consume batches of log events from a channel and write them to CWL.
 type Writer struct {
 	batches    <-chan *batch.Batch
@@ -40,6 +46,9 @@ type Writer struct {
 	logGroup   string
 	logStream  string
 	saveCursor SaveCursor
+
+	// saveInFlight is optional. If set, batches are marked in-flight before writing.
+	saveInFlight SaveInFlight
 }
 
 func NewWriter(
@@ -48,43 +57,97 @@ func NewWriter(
 	logGroup string,
 	logStream string,
 	saveCursor SaveCursor,
+	opts ...Option,
 ) *Writer {
-	return &Writer{
+	w := Writer{
 		batches:    batches,
 		cwlClient:  cwlClient,
 		logGroup:   logGroup,
 		logStream:  logStream,
 		saveCursor: saveCursor,
 	}
+	for _, opt := range opts {
+		opt(&w)
+	}
+	return &w
 }
 
-// Write log events to CWL. It panics if it cannot send events to CWL.
+// Write log events to CWL, until the ctx is canceled or the batches channel is closed. It panics if it cannot send
+// events to CWL. If the ctx is canceled while a batch is written, it returns without saving the cursor, and the
+// in-flight marker tells on restart whether the batch was written.
 func (w *Writer) Write(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case batch := <-w.batches:
+		case batch, ok := <-w.batches:
+			if !ok {
+				return
+			}
+			w.markInFlight(batch)
 			err := w.writeBatch(ctx, batch.Events)
-			if err == nil {
-				if err := w.saveCursor(batch.Cursor); err != nil {
-					zap.S().Panicf("cannot save cursor, %w", err)
+			if err != nil {
+				if err == errThrottled {
+					time.Sleep(timeToWaitOnThrottle)
+				} else if w.acknowledged(ctx, batch) {
+					// The request failed, e.g. timed out, after CWL had taken the batch. Do not send it twice.
+					err = nil
 				}
-				continue
 			}
-			if err == errThrottled {
-				time.Sleep(timeToWaitOnThrottle)
+			if err != nil {
+				if err := w.writeBatch(ctx, batch.Events); err != nil {
+					if ctx.Err() != nil {
+						return
+					}
+					zap.S().Panicf("cannot write events to CWL, %v", err)
+				}
 			}
-			if err := w.writeBatch(ctx, batch.Events); err != nil {
-				zap.S().Panicf("cannot write events to CWL", err)
+			// A batch has no cursor if it only has log events of the first entry, which spans batches. Saving the empty
+			// cursor would delete the saved one.
+			if batch.Cursor != "" {
 				if err := w.saveCursor(batch.Cursor); err != nil {
-					zap.S().Panicf("cannot save cursor, %w", err)
+					zap.S().Panicf("cannot save cursor, %v", err)
 				}
 			}
+			w.clearInFlight()
 		}
 	}
 }
 
+// markInFlight saves the in-flight marker of the batch. Failing to save it only loses the duplicate protection, so the
+// batch is written anyway.
+func (w *Writer) markInFlight(b *batch.Batch) {
+	if w.saveInFlight == nil || len(b.Events) == 0 {
+		return
+	}
+	if err := w.saveInFlight(NewInFlight(b).String()); err != nil {
+		zap.S().Errorf("cannot save in-flight marker, %v", err)
+	}
+}
+
+func (w *Writer) clearInFlight() {
+	if w.saveInFlight == nil {
+		return
+	}
+	if err := w.saveInFlight(""); err != nil {
+		zap.S().Errorf("cannot clear in-flight marker, %v", err)
+	}
+}
+
+// acknowledged tells whether CWL has the batch. It is only checked when in-flight markers are enabled, because that
+// needs the logs:GetLogEvents permission.
+func (w *Writer) acknowledged(ctx context.Context, b *batch.Batch) bool {
+	if w.saveInFlight == nil || len(b.Events) == 0 {
+		return false
+	}
+	ok, err := Acknowledged(ctx, w.cwlClient, w.logGroup, w.logStream, NewInFlight(b))
+	if err != nil {
+		zap.S().Errorf("cannot verify whether the batch is written, write it again. %v", err)
+		return false
+	}
+	return ok
+}
+
 func (w *Writer) writeBatch(ctx context.Context, events []types.InputLogEvent) error {
 	putEvents := func(events []types.InputLogEvent) error {
 		request := &cloudwatchlogs.PutLogEventsInput{
@@ -125,3 +188,13 @@ func (w *Writer) writeBatch(ctx context.Context, events []types.InputLogEvent) e
 
 	return err
 }
+
+type Option func(*Writer)
+
+// WithSaveInFlight marks each batch in-flight before writing it, so a batch interrupted by a restart can be verified
+// with Acknowledged instead of being written again.
+func WithSaveInFlight(saveInFlight SaveInFlight) Option {
+	return func(w *Writer) {
+		w.saveInFlight = saveInFlight
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
 	"sync"
 	"testing"
 
@@ -70,6 +71,49 @@ func TestWriteBatches(t *testing.T) {
 	}
 }
 
+// TestWriteSkipsEmptyCursor tests that a batch without a cursor does not delete the saved cursor.
+func TestWriteSkipsEmptyCursor(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	batches := make(chan *batch.Batch)
+	go func() {
+		defer cancel()
+		batches <- &batch.Batch{Events: make([]types.InputLogEvent, 1)}
+		batches <- &batch.Batch{Events: make([]types.InputLogEvent, 1), Cursor: "cursor-0"}
+	}()
+
+	var cursors []string
+	s := &cwlStub{}
+	w := NewWriter(batches, s, "journal-logs", "i-11111111111111111",
+		func(cursor string) error {
+			cursors = append(cursors, cursor)
+			return nil
+		})
+	w.Write(ctx)
+
+	assert.Equal(t, 2, s.eventsCnt)
+	assert.Equal(t, []string{"cursor-0"}, cursors)
+}
+
+func TestWriteReturnsWhenBatchesEnd(t *testing.T) {
+	batches := make(chan *batch.Batch, 1)
+	batches <- &batch.Batch{Events: make([]types.InputLogEvent, 1), Cursor: "cursor-0"}
+	close(batches)
+
+	var cursors []string
+	s := &cwlStub{}
+	w := NewWriter(batches, s, "journal-logs", "i-11111111111111111",
+		func(cursor string) error {
+			cursors = append(cursors, cursor)
+			return nil
+		})
+	w.Write(context.Background())
+
+	assert.Equal(t, 1, s.eventsCnt)
+	assert.Equal(t, []string{"cursor-0"}, cursors)
+}
+
 func TestPanicOnError(t *testing.T) {
 	cases := []struct {
 		name                 string
@@ -127,6 +171,13 @@ type cwlStub struct {
 	eventsCnt            int
 	errOnPutLogEvents    error
 	errOnCreateLogStream error
+
+	// PutLogEvents fails with this error once.
+	errOnPutLogEventsOnce error
+
+	// Pages of events that GetLogEvents returns.
+	pages          [][]types.OutputLogEvent
+	errOnGetEvents error
 }
 
 func (s *cwlStub) PutLogEvents(_ context.Context, params *cloudwatchlogs.PutLogEventsInput,
@@ -134,6 +185,10 @@ func (s *cwlStub) PutLogEvents(_ context.Context, params *cloudwatchlogs.PutLogE
 	if s.errOnPutLogEvents != nil {
 		return nil, s.errOnPutLogEvents
 	}
+	if err := s.errOnPutLogEventsOnce; err != nil {
+		s.errOnPutLogEventsOnce = nil
+		return nil, err
+	}
 	s.eventsCnt += len(params.LogEvents)
 	return nil, nil //nolint:nilnil
 }
@@ -142,3 +197,21 @@ func (s *cwlStub) CreateLogStream(context.Context, *cloudwatchlogs.CreateLogStre
 	...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.CreateLogStreamOutput, error) {
 	return nil, s.errOnCreateLogStream
 }
+
+func (s *cwlStub) GetLogEvents(_ context.Context, params *cloudwatchlogs.GetLogEventsInput,
+	_ ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.GetLogEventsOutput, error) {
+	if s.errOnGetEvents != nil {
+		return nil, s.errOnGetEvents
+	}
+	page := 0
+	if params.NextToken != nil {
+		page, _ = strconv.Atoi(*params.NextToken)
+	}
+	output := &cloudwatchlogs.GetLogEventsOutput{
+		NextForwardToken: aws.String(strconv.Itoa(min(page+1, len(s.pages)))),
+	}
+	if page < len(s.pages) {
+		output.Events = s.pages[page]
+	}
+	return output, nil
+}
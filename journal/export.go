@@ -0,0 +1,233 @@
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/sdjournal"
+)
+
+// Stdin as the export file name reads the export from the standard input.
+const Stdin = "-"
+
+// ExportReader reads journal entries in the Journal Export Format, https://systemd.io/JOURNAL_EXPORT_FORMATS/, which is
+// what `journalctl -o export` emits. It implements ReaderAPI, so it can replace the journal of a Reader.
+type ExportReader struct {
+	r      *bufio.Reader
+	closer io.Closer
+
+	// The entry that Next advanced to.
+	entry *sdjournal.JournalEntry
+
+	// Entries at or before this position are skipped, to resume from a cursor.
+	after *Position
+
+	// Whether the end of the export is read.
+	end bool
+}
+
+// NewExportReader returns a reader of the export. If the cursor is not empty, the reader skips entries up to and
+// including the entry at the cursor. The cursor is compared by position, so it does not need to be in the export.
+func NewExportReader(r io.Reader, cursor string) (*ExportReader, error) {
+	e := ExportReader{
+		r: bufio.NewReader(r),
+	}
+	if c, ok := r.(io.Closer); ok {
+		e.closer = c
+	}
+	if cursor != "" {
+		p, err := ParseCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		e.after = &p
+	}
+	return &e, nil
+}
+
+// OpenExportFile returns a reader of the export file, or the standard input if the file name is Stdin.
+func OpenExportFile(fileName string, cursor string) (*ExportReader, error) {
+	if fileName == Stdin {
+		return NewExportReader(io.NopCloser(os.Stdin), cursor)
+	}
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open journal export file, %w", err)
+	}
+	e, err := NewExportReader(f, cursor)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return e, nil
+}
+
+// Next advances to the next entry. It returns 0 at the end of the export.
+func (e *ExportReader) Next() (uint64, error) {
+	for {
+		entry, err := e.readEntry()
+		if err != nil {
+			return 0, err
+		}
+		if entry == nil {
+			e.end = true
+			return 0, nil
+		}
+		if e.after != nil {
+			p, err := ParseCursor(entry.Cursor)
+			if err == nil && !p.After(*e.after) {
+				continue
+			}
+			e.after = nil
+		}
+		e.entry = entry
+		return 1, nil
+	}
+}
+
+// GetEntry returns the entry that Next advanced to.
+func (e *ExportReader) GetEntry() (*sdjournal.JournalEntry, error) {
+	if e.entry == nil {
+		return nil, errors.New("no entry, call Next first")
+	}
+	return e.entry, nil
+}
+
+// AtEnd tells whether Next read the end of the export. A stream, e.g. the standard input, ends when it is closed.
+func (e *ExportReader) AtEnd() bool {
+	return e.end
+}
+
+// Wait waits for the timeout. An export does not change, unless it is a stream that Next blocks on anyway.
+func (e *ExportReader) Wait(timeout time.Duration) int {
+	time.Sleep(timeout)
+	return sdjournal.SD_JOURNAL_NOP
+}
+
+// SeekRealtimeUsec skips entries before the realtime timestamp in microseconds.
+func (e *ExportReader) SeekRealtimeUsec(usec uint64) error {
+	if usec == 0 {
+		e.after = nil
+		return nil
+	}
+	e.after = &Position{Realtime: usec - 1}
+	return nil
+}
+
+// GetDataValue returns the value of the field of the entry that Next advanced to.
+func (e *ExportReader) GetDataValue(field string) (string, error) {
+	entry, err := e.GetEntry()
+	if err != nil {
+		return "", err
+	}
+	v, ok := entry.Fields[field]
+	if !ok {
+		return "", fmt.Errorf("no field %s", field)
+	}
+	return v, nil
+}
+
+func (e *ExportReader) Close() error {
+	if e.closer == nil {
+		return nil
+	}
+	return e.closer.Close()
+}
+
+// readEntry reads the next entry, or returns nil at the end of the export. Entries are separated by an empty line.
+// A field is either "KEY=value\n", or "KEY\n" followed by the value size in 64-bit little endian, the value and "\n"
+// for values that are binary or contain new lines.
+func (e *ExportReader) readEntry() (*sdjournal.JournalEntry, error) {
+	entry := &sdjournal.JournalEntry{Fields: make(map[string]string)}
+	var seqnumID, seqnum string
+	numFields := 0
+	for {
+		line, err := e.r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) && len(line) == 0 {
+			// The last entry may not end with an empty line.
+			if numFields == 0 {
+				return nil, nil //nolint:nilnil
+			}
+			break
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("cannot read journal export, %w", err)
+		}
+		line = bytes.TrimSuffix(line, []byte("\n"))
+		if len(line) == 0 {
+			if numFields == 0 {
+				continue
+			}
+			break
+		}
+
+		var key, value string
+		if k, v, ok := bytes.Cut(line, []byte("=")); ok {
+			key, value = string(k), string(v)
+		} else {
+			key = string(line)
+			if value, err = e.readBinaryValue(); err != nil {
+				return nil, fmt.Errorf("cannot read field %s of journal export, %w", key, err)
+			}
+		}
+		numFields++
+
+		switch key {
+		case "__CURSOR":
+			entry.Cursor = value
+		case "__REALTIME_TIMESTAMP":
+			entry.RealtimeTimestamp, _ = strconv.ParseUint(value, 10, 64)
+		case "__MONOTONIC_TIMESTAMP":
+			entry.MonotonicTimestamp, _ = strconv.ParseUint(value, 10, 64)
+		case "__SEQNUM_ID":
+			seqnumID = value
+		case "__SEQNUM":
+			seqnum = value
+		default:
+			// Like sd-journal, address fields starting with double underscores are not data fields.
+			if !strings.HasPrefix(key, "__") {
+				entry.Fields[key] = value
+			}
+		}
+	}
+
+	if entry.Cursor == "" {
+		entry.Cursor = synthesizeCursor(entry, seqnumID, seqnum)
+	}
+	return entry, nil
+}
+
+func (e *ExportReader) readBinaryValue() (string, error) {
+	var size uint64
+	if err := binary.Read(e.r, binary.LittleEndian, &size); err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	if _, err := io.CopyN(&sb, e.r, int64(size)); err != nil { //nolint:gosec
+		return "", err
+	}
+	if b, err := e.r.ReadByte(); err != nil || b != '\n' {
+		return "", errors.New("binary value does not end with a new line")
+	}
+	return sb.String(), nil
+}
+
+// synthesizeCursor makes a cursor for an entry exported without __CURSOR, from the address fields that the export has.
+func synthesizeCursor(entry *sdjournal.JournalEntry, seqnumID, seqnum string) string {
+	p := Position{
+		SeqnumID:  seqnumID,
+		BootID:    entry.Fields["_BOOT_ID"],
+		Monotonic: entry.MonotonicTimestamp,
+		Realtime:  entry.RealtimeTimestamp,
+	}
+	p.Seqnum, _ = strconv.ParseUint(seqnum, 10, 64)
+	return p.String()
+}
@@ -0,0 +1,153 @@
+package journal
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/sdjournal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportReader(t *testing.T) {
+	export := exampleExport(3)
+
+	e, err := NewExportReader(bytes.NewReader(export), "")
+	assert.NoError(t, err)
+	var entries []*sdjournal.JournalEntry
+	for {
+		advanced, err := e.Next()
+		assert.NoError(t, err)
+		if advanced == 0 {
+			break
+		}
+		entry, err := e.GetEntry()
+		assert.NoError(t, err)
+		entries = append(entries, entry)
+	}
+
+	assert.Len(t, entries, 3)
+	assert.Equal(t, &sdjournal.JournalEntry{
+		Fields: map[string]string{
+			"_BOOT_ID":    "f595e6391111111111111111372bf520",
+			"_MACHINE_ID": "ec22e31111111111111111111111115b",
+			"_PID":        "1",
+			"MESSAGE":     "line 0\nline 1\x00",
+		},
+		Cursor:             exampleCursor(0),
+		RealtimeTimestamp:  1722650790111473,
+		MonotonicTimestamp: 897993707018,
+	}, entries[0])
+	// The last entry does not have __CURSOR, its cursor is synthesized from the address fields.
+	assert.Equal(t, exampleCursor(2), entries[2].Cursor)
+
+	id, err := e.GetDataValue("_MACHINE_ID")
+	assert.NoError(t, err)
+	assert.Equal(t, "ec22e31111111111111111111111115b", id)
+}
+
+func TestExportReaderResumesAfterCursor(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "export")
+	assert.NoError(t, os.WriteFile(f, exampleExport(5), 0600))
+
+	e, err := OpenExportFile(f, exampleCursor(2))
+	assert.NoError(t, err)
+	defer e.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := NewReader(e, WithWaitForDataTimeout(time.Millisecond))
+	go func() {
+		_ = r.Read(ctx)
+	}()
+	assert.Equal(t, exampleCursor(3), (<-r.Entries()).Cursor)
+	assert.Equal(t, uint64(1722650790111473+4), (<-r.Entries()).RealtimeTimestamp)
+}
+
+// TestExportReaderEnds tests that reading an export stops at its end, and the entries channel is closed then.
+func TestExportReaderEnds(t *testing.T) {
+	e, err := NewExportReader(bytes.NewReader(exampleExport(3)), "")
+	assert.NoError(t, err)
+	assert.False(t, e.AtEnd())
+
+	r := NewReader(e, WithWaitForDataTimeout(time.Millisecond))
+	readErr := make(chan error, 1)
+	go func() {
+		readErr <- r.Read(context.Background())
+	}()
+	var cursors []string
+	for entry := range r.Entries() {
+		cursors = append(cursors, entry.Cursor)
+	}
+	assert.Equal(t, []string{exampleCursor(0), exampleCursor(1), exampleCursor(2)}, cursors)
+	assert.NoError(t, <-readErr)
+	assert.True(t, e.AtEnd())
+}
+
+func TestExportReaderSeekRealtimeUsec(t *testing.T) {
+	e, err := NewExportReader(bytes.NewReader(exampleExport(5)), "")
+	assert.NoError(t, err)
+	assert.NoError(t, e.SeekRealtimeUsec(1722650790111473+3))
+	advanced, err := e.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), advanced)
+	entry, err := e.GetEntry()
+	assert.NoError(t, err)
+	assert.Equal(t, exampleCursor(3), entry.Cursor)
+}
+
+func TestExportReader_Invalid(t *testing.T) {
+	_, err := NewExportReader(bytes.NewReader(nil), "cursor-0")
+	assert.Error(t, err)
+
+	e, err := NewExportReader(bytes.NewReader([]byte("MESSAGE\n\xff\xff")), "")
+	assert.NoError(t, err)
+	_, err = e.Next()
+	assert.Error(t, err)
+}
+
+func exampleCursor(i int) string {
+	p := Position{
+		SeqnumID:  "f4c4c1111111111111111111111111e2",
+		Seqnum:    uint64(i + 1),
+		BootID:    "f595e6391111111111111111372bf520",
+		Monotonic: uint64(897993707018 + i),
+		Realtime:  uint64(1722650790111473 + i),
+	}
+	return p.String()
+}
+
+// exampleExport returns an export of n entries. The first entry has a binary MESSAGE and the last entry does not have
+// __CURSOR and the trailing empty line.
+func exampleExport(n int) []byte {
+	var b bytes.Buffer
+	for i := 0; i < n; i++ {
+		if i < n-1 {
+			fmt.Fprintf(&b, "__CURSOR=%s\n", exampleCursor(i))
+		}
+		fmt.Fprintf(&b, "__REALTIME_TIMESTAMP=%d\n", 1722650790111473+i)
+		fmt.Fprintf(&b, "__MONOTONIC_TIMESTAMP=%d\n", 897993707018+i)
+		fmt.Fprintf(&b, "__SEQNUM=%d\n", i+1)
+		b.WriteString("__SEQNUM_ID=f4c4c1111111111111111111111111e2\n")
+		b.WriteString("_BOOT_ID=f595e6391111111111111111372bf520\n")
+		b.WriteString("_MACHINE_ID=ec22e31111111111111111111111115b\n")
+		b.WriteString("_PID=1\n")
+		if i == 0 {
+			msg := "line 0\nline 1\x00"
+			b.WriteString("MESSAGE\n")
+			_ = binary.Write(&b, binary.LittleEndian, uint64(len(msg)))
+			b.WriteString(msg + "\n")
+		} else {
+			fmt.Fprintf(&b, "MESSAGE=line %d\n", i)
+		}
+		if i < n-1 {
+			b.WriteString("\n")
+		}
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,96 @@
+package journal
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/sdjournal"
+)
+
+// Fields of the synthetic entry that reports a gap in the journal, e.g. entries vacuumed while journald-to-cwl was not
+// running. The timestamps are realtime timestamps in microseconds.
+const (
+	GapFromField  = "JOURNALD_TO_CWL_GAP_FROM"
+	GapToField    = "JOURNALD_TO_CWL_GAP_TO"
+	GapCountField = "JOURNALD_TO_CWL_GAP_COUNT"
+)
+
+// CursorTesterAPI describes API that tests whether the current entry is at a cursor. The API is a subset of
+// sdjournal.Journal.
+type CursorTesterAPI interface {
+	TestCursor(cursor string) error
+}
+
+// gapCheck checks whether the first entry read after opening the journal is the successor of the last delivered entry.
+type gapCheck struct {
+	// Cursor of the last delivered entry.
+	cursor string
+
+	// Whether the entry at cursor no longer exists in the journal.
+	cursorMissing bool
+}
+
+// gapBefore returns a synthetic entry describing the entries missing between the last delivered entry and the given
+// entry, or nil if there is no gap. Seqnums of consecutive entries are consecutive only if the journal is not filtered
+// and both entries come from the same seqnum id. Otherwise, a gap is reported only if the last delivered entry no
+// longer exists.
+func (g gapCheck) gapBefore(entry *sdjournal.JournalEntry, filtered bool) *sdjournal.JournalEntry {
+	prev, err := ParseCursor(g.cursor)
+	if err != nil {
+		return nil
+	}
+	next, err := ParseCursor(entry.Cursor)
+	if err != nil {
+		return nil
+	}
+
+	sameSeqnumID := prev.SeqnumID != "" && prev.SeqnumID == next.SeqnumID
+	var count uint64
+	if sameSeqnumID && next.Seqnum > prev.Seqnum {
+		count = next.Seqnum - prev.Seqnum - 1
+	}
+	switch {
+	case sameSeqnumID && count == 0:
+		return nil
+	case !g.cursorMissing && (filtered || !sameSeqnumID):
+		return nil
+	}
+
+	from, to := usecToTime(prev.Realtime), usecToTime(next.Realtime)
+	var message string
+	switch {
+	case count == 0:
+		message = fmt.Sprintf("journald-to-cwl detected missing journal entries between %s and %s, number unknown",
+			from.Format(time.RFC3339Nano), to.Format(time.RFC3339Nano))
+	case filtered:
+		message = fmt.Sprintf("journald-to-cwl detected up to %d missing journal entries between %s and %s",
+			count, from.Format(time.RFC3339Nano), to.Format(time.RFC3339Nano))
+	default:
+		message = fmt.Sprintf("journald-to-cwl detected %d missing journal entries between %s and %s",
+			count, from.Format(time.RFC3339Nano), to.Format(time.RFC3339Nano))
+	}
+
+	gap := &sdjournal.JournalEntry{
+		Fields: map[string]string{
+			"MESSAGE":           message,
+			"PRIORITY":          "4",
+			"SYSLOG_IDENTIFIER": "journald-to-cwl",
+			"_MACHINE_ID":       entry.Fields["_MACHINE_ID"],
+			"_HOSTNAME":         entry.Fields["_HOSTNAME"],
+			GapFromField:        strconv.FormatUint(prev.Realtime, 10),
+			GapToField:          strconv.FormatUint(next.Realtime, 10),
+		},
+		// The gap does not move the position, so saving its cursor is the same as saving the last delivered entry.
+		Cursor:            g.cursor,
+		RealtimeTimestamp: next.Realtime,
+	}
+	if count > 0 {
+		gap.Fields[GapCountField] = strconv.FormatUint(count, 10)
+	}
+	return gap
+}
+
+func usecToTime(usec uint64) time.Time {
+	return time.UnixMicro(int64(usec)).UTC() //nolint:gosec
+}
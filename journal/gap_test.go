@@ -0,0 +1,79 @@
+package journal
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/sdjournal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGapBefore(t *testing.T) {
+	prev := Position{SeqnumID: "a", Seqnum: 10, Realtime: 1722650790111473}
+	cases := []struct {
+		name          string
+		next          Position
+		cursorMissing bool
+		filtered      bool
+		expectGap     bool
+		expectedCount string
+	}{
+		{"successor", Position{SeqnumID: "a", Seqnum: 11, Realtime: 1722650790111474}, false, false, false, ""},
+		{"successor of missing cursor", Position{SeqnumID: "a", Seqnum: 11}, true, false, false, ""},
+		{"seqnum jump", Position{SeqnumID: "a", Seqnum: 21, Realtime: 1722650800111473}, false, false, true, "10"},
+		{"seqnum jump when filtered", Position{SeqnumID: "a", Seqnum: 21}, false, true, false, ""},
+		{"seqnum jump and missing cursor when filtered", Position{SeqnumID: "a", Seqnum: 21}, true, true, true, "10"},
+		{"different seqnum id", Position{SeqnumID: "b", Seqnum: 1}, false, false, false, ""},
+		{"different seqnum id and missing cursor", Position{SeqnumID: "b", Seqnum: 1}, true, false, true, ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			check := gapCheck{cursor: prev.String(), cursorMissing: tc.cursorMissing}
+			entry := &sdjournal.JournalEntry{
+				Fields: map[string]string{"_MACHINE_ID": "ec22e31111111111111111111111115b"},
+				Cursor: tc.next.String(),
+			}
+			gap := check.gapBefore(entry, tc.filtered)
+			if !tc.expectGap {
+				assert.Nil(t, gap)
+				return
+			}
+			assert.NotNil(t, gap)
+			assert.Equal(t, prev.String(), gap.Cursor)
+			assert.Equal(t, fmt.Sprint(prev.Realtime), gap.Fields[GapFromField])
+			assert.Equal(t, fmt.Sprint(tc.next.Realtime), gap.Fields[GapToField])
+			assert.Equal(t, tc.expectedCount, gap.Fields[GapCountField])
+			assert.Equal(t, "ec22e31111111111111111111111115b", gap.Fields["_MACHINE_ID"])
+			assert.NotEmpty(t, gap.Fields["MESSAGE"])
+		})
+	}
+}
+
+func TestReadReportsGap(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The entries before seqnum 5 were vacuumed.
+	var entries []*sdjournal.JournalEntry
+	for i := 5; i < 10; i++ {
+		entries = append(entries, &sdjournal.JournalEntry{
+			Cursor: Position{SeqnumID: "a", Seqnum: uint64(i), Realtime: uint64(i)}.String(),
+		})
+	}
+	lastCursor := Position{SeqnumID: "a", Seqnum: 2, Realtime: 2}.String()
+	r := NewReader(newJournalStub(entries), WithWaitForDataTimeout(time.Millisecond),
+		WithLastCursor(lastCursor), WithGapDetection(false))
+	go func() {
+		_ = r.Read(ctx)
+	}()
+
+	gap := <-r.Entries()
+	assert.Equal(t, lastCursor, gap.Cursor)
+	assert.Equal(t, "2", gap.Fields[GapCountField])
+	for _, entry := range entries {
+		assert.Equal(t, entry, <-r.Entries())
+	}
+}
@@ -0,0 +1,36 @@
+package journal
+
+import (
+	"time"
+)
+
+// TailFunc returns the position of the newest entry in the journal.
+type TailFunc func() (Position, error)
+
+// Lag is how far the reader is behind the newest entry in the journal.
+type Lag struct {
+	// Entries between the last read entry and the newest entry. It is only known when both have the same seqnum id.
+	Entries      uint64
+	EntriesKnown bool
+
+	// Duration between realtime timestamps of the last read entry and the newest entry.
+	Duration time.Duration
+
+	// When the lag was measured. It is zero if the lag was never measured.
+	MeasuredAt time.Time
+}
+
+// lagBetween returns the lag of the last read entry at last behind the newest entry at tail.
+func lagBetween(last, tail Position, now time.Time) Lag {
+	lag := Lag{MeasuredAt: now}
+	if last.SeqnumID != "" && last.SeqnumID == tail.SeqnumID {
+		lag.EntriesKnown = true
+		if tail.Seqnum > last.Seqnum {
+			lag.Entries = tail.Seqnum - last.Seqnum
+		}
+	}
+	if tail.Realtime > last.Realtime {
+		lag.Duration = time.Duration(tail.Realtime-last.Realtime) * time.Microsecond //nolint:gosec
+	}
+	return lag
+}
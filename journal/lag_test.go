@@ -0,0 +1,99 @@
+package journal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/sdjournal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLagBetween(t *testing.T) {
+	now := time.Now()
+	cases := []struct {
+		name     string
+		last     Position
+		tail     Position
+		expected Lag
+	}{
+		{
+			"behind",
+			Position{SeqnumID: "a", Seqnum: 10, Realtime: 1_000_000},
+			Position{SeqnumID: "a", Seqnum: 25, Realtime: 61_000_000},
+			Lag{Entries: 15, EntriesKnown: true, Duration: time.Minute, MeasuredAt: now},
+		},
+		{
+			"caught up",
+			Position{SeqnumID: "a", Seqnum: 25, Realtime: 61_000_000},
+			Position{SeqnumID: "a", Seqnum: 25, Realtime: 61_000_000},
+			Lag{EntriesKnown: true, MeasuredAt: now},
+		},
+		{
+			"different seqnum id",
+			Position{SeqnumID: "a", Seqnum: 10, Realtime: 1_000_000},
+			Position{SeqnumID: "b", Seqnum: 2, Realtime: 2_000_000},
+			Lag{Duration: time.Second, MeasuredAt: now},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, lagBetween(tc.last, tc.tail, now))
+		})
+	}
+}
+
+func TestReaderLag(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var entries []*sdjournal.JournalEntry
+	for i := 0; i < 3; i++ {
+		p := Position{SeqnumID: "a", Seqnum: uint64(i), Realtime: uint64(i) * 1_000_000}
+		entries = append(entries, &sdjournal.JournalEntry{Cursor: p.String(), RealtimeTimestamp: p.Realtime})
+	}
+	tail := func() (Position, error) {
+		return Position{SeqnumID: "a", Seqnum: 10, Realtime: 10_000_000}, nil
+	}
+	r := NewReader(newJournalStub(entries), WithWaitForDataTimeout(time.Millisecond), WithLag(tail, time.Millisecond))
+	assert.Equal(t, Lag{}, r.Lag())
+	go func() {
+		_ = r.Read(ctx)
+	}()
+	for range entries {
+		<-r.Entries()
+	}
+
+	assert.Eventually(t, func() bool {
+		lag := r.Lag()
+		return lag.Entries == 8 && lag.Duration == 8*time.Second
+	}, time.Second, time.Millisecond)
+}
+
+// TestReaderLagWhileBlocked tests that the lag is measured while no entry is taken from the channel.
+func TestReaderLagWhileBlocked(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var entries []*sdjournal.JournalEntry
+	for i := 0; i < 3; i++ {
+		p := Position{SeqnumID: "a", Seqnum: uint64(i), Realtime: uint64(i) * 1_000_000}
+		entries = append(entries, &sdjournal.JournalEntry{Cursor: p.String(), RealtimeTimestamp: p.Realtime})
+	}
+	tail := func() (Position, error) {
+		return Position{SeqnumID: "a", Seqnum: 10, Realtime: 10_000_000}, nil
+	}
+	r := NewReader(newJournalStub(entries), WithWaitForDataTimeout(time.Millisecond),
+		WithLag(tail, 10*time.Millisecond))
+	go func() {
+		_ = r.Read(ctx)
+	}()
+	// The reader is blocked sending the second entry.
+	<-r.Entries()
+
+	assert.Eventually(t, func() bool {
+		lag := r.Lag()
+		return lag.Entries == 10 && lag.Duration == 10*time.Second
+	}, time.Second, time.Millisecond)
+}
@@ -0,0 +1,35 @@
+package journal
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MachineIDAPI describes API that reads the machine id from journal. The API is a subset of sdjournal.Journal.
+type MachineIDAPI interface {
+	SeekHead() error
+
+	Next() (uint64, error)
+
+	GetDataValue(field string) (string, error)
+}
+
+// MachineID returns the machine id of the oldest entry in the journal. It moves the read position, so use a separate
+// journal or seek again before reading entries.
+func MachineID(j MachineIDAPI) (string, error) {
+	if err := j.SeekHead(); err != nil {
+		return "", fmt.Errorf("cannot seek to head, %w", err)
+	}
+	advanced, err := j.Next()
+	if err != nil {
+		return "", fmt.Errorf("cannot read the oldest entry, %w", err)
+	}
+	if advanced == 0 {
+		return "", errors.New("journal is empty")
+	}
+	v, err := j.GetDataValue("_MACHINE_ID")
+	if err != nil {
+		return "", fmt.Errorf("cannot read machine id, %w", err)
+	}
+	return v, nil
+}
@@ -0,0 +1,57 @@
+package journal
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMachineID(t *testing.T) {
+	cases := []struct {
+		name        string
+		j           *machineIDStub
+		expectedID  string
+		expectError bool
+	}{
+		{
+			"ok",
+			&machineIDStub{entries: 1, machineID: "ec22e31111111111111111111111115b"},
+			"ec22e31111111111111111111111115b",
+			false,
+		},
+		{"empty journal", &machineIDStub{}, "", true},
+		{"no machine id field", &machineIDStub{entries: 1, err: errors.New("no such file or directory")}, "", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			id, err := MachineID(tc.j)
+			if tc.expectError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedID, id)
+		})
+	}
+}
+
+// machineIDStub pretends to be a journal with the given number of entries of the same machine id.
+type machineIDStub struct {
+	entries   uint64
+	machineID string
+	err       error
+}
+
+func (j *machineIDStub) SeekHead() error {
+	return nil
+}
+
+func (j *machineIDStub) Next() (uint64, error) {
+	return min(j.entries, 1), nil
+}
+
+func (j *machineIDStub) GetDataValue(string) (string, error) {
+	return j.machineID, j.err
+}
@@ -0,0 +1,28 @@
+package journal
+
+import "fmt"
+
+// MatcherAPI describes API that filters journal entries. The API is a subset of sdjournal.Journal.
+type MatcherAPI interface {
+	AddMatch(match string) error
+
+	AddDisjunction() error
+}
+
+// AddMatches adds groups of "FIELD=value" matches to the journal. Matches within a group are ANDed, except matches on
+// the same field which journald ORs, and groups are ORed. It must be called before reading any entry.
+func AddMatches(j MatcherAPI, groups [][]string) error {
+	for i, group := range groups {
+		if i > 0 {
+			if err := j.AddDisjunction(); err != nil {
+				return fmt.Errorf("cannot add journal disjunction, %w", err)
+			}
+		}
+		for _, match := range group {
+			if err := j.AddMatch(match); err != nil {
+				return fmt.Errorf("cannot add journal match %s, %w", match, err)
+			}
+		}
+	}
+	return nil
+}
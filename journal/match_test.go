@@ -0,0 +1,49 @@
+package journal
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddMatches(t *testing.T) {
+	cases := []struct {
+		name          string
+		groups        [][]string
+		expectedCalls []string
+	}{
+		{"no groups", nil, nil},
+		{"one group", [][]string{{"A=1", "B=2"}}, []string{"A=1", "B=2"}},
+		{"two groups", [][]string{{"A=1"}, {"B=2", "C=3"}}, []string{"A=1", "OR", "B=2", "C=3"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &matcherStub{}
+			assert.NoError(t, AddMatches(m, tc.groups))
+			assert.Equal(t, tc.expectedCalls, m.calls)
+		})
+	}
+}
+
+func TestAddMatches_Error(t *testing.T) {
+	m := &matcherStub{err: errors.New("invalid argument")}
+	assert.Error(t, AddMatches(m, [][]string{{"A=1"}}))
+}
+
+// matcherStub records the matches and disjunctions added to it.
+type matcherStub struct {
+	calls []string
+	err   error
+}
+
+func (m *matcherStub) AddMatch(match string) error {
+	m.calls = append(m.calls, match)
+	return m.err
+}
+
+func (m *matcherStub) AddDisjunction() error {
+	m.calls = append(m.calls, "OR")
+	return m.err
+}
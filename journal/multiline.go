@@ -0,0 +1,310 @@
+package journal
+
+import (
+	"context"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/coreos/go-systemd/v22/sdjournal"
+)
+
+const (
+	defaultMultilineTimeout = time.Second
+
+	defaultMultilineMaxLines = 1000
+)
+
+// TruncatedField is "true" on an entry whose MESSAGE, or the MESSAGE of any entry merged into it, reached the data
+// threshold of the journal, see WithDataThreshold. The threshold applies to the entries as they are stored, so it is
+// checked before they are merged.
+const TruncatedField = "JOURNALD_TO_CWL_TRUNCATED"
+
+// Assembler merges entries that belong to one message. It reassembles the lines that Docker's journald log driver
+// splits into several entries, see partialMessages, and merges consecutive entries of the same unit and PID, e.g. the
+// lines of a stack trace that a service writes to stdout, which journald stores as one entry per line.
+//
+// A line continues the message before it if it matches the continuation pattern, or if it does not match the start
+// pattern. The merged entry is the first entry with the MESSAGE of all lines joined by "\n", and the cursor of the last
+// line, so the cursor only advances past the lines once all of them are delivered.
+type Assembler struct {
+	entries <-chan *sdjournal.JournalEntry
+
+	assembled chan *sdjournal.JournalEntry
+
+	// A line that matches start starts a new message, a line that matches continuation continues the message before.
+	// Either can be nil.
+	start        *regexp.Regexp
+	continuation *regexp.Regexp
+
+	// Units whose entries are merged, by _SYSTEMD_UNIT or SYSLOG_IDENTIFIER. All units if empty.
+	units []string
+
+	// Time to wait for the next line before delivering the message.
+	timeout time.Duration
+
+	// Maximum number of lines of one message. The next line starts a new message.
+	maxLines int
+
+	// Lines of containers that are not complete yet.
+	partials partialMessages
+
+	// The journal data threshold, 0 if there is no threshold.
+	dataThreshold int
+}
+
+// NewAssembler returns an Assembler of the entries. Lines of containers are always reassembled, other entries are
+// passed through as they are unless a start or a continuation pattern is set.
+func NewAssembler(entries <-chan *sdjournal.JournalEntry, opts ...AssemblerOption) *Assembler {
+	a := Assembler{
+		entries:   entries,
+		assembled: make(chan *sdjournal.JournalEntry),
+		timeout:   defaultMultilineTimeout,
+		maxLines:  defaultMultilineMaxLines,
+	}
+	for _, opt := range opts {
+		opt(&a)
+	}
+	return &a
+}
+
+// Entries returns a channel of assembled JournalEntry. The returned channel is closed only when the input channel is
+// closed, after the pending lines and messages are delivered.
+func (a *Assembler) Entries() <-chan *sdjournal.JournalEntry {
+	return a.assembled
+}
+
+// Assemble merges entries until the ctx is canceled or the entries channel is closed. Assemble should be called only
+// once per assembler. A message that is not delivered when the ctx is canceled is read again on restart, since its
+// cursor is not delivered.
+func (a *Assembler) Assemble(ctx context.Context) {
+	var pending *sdjournal.JournalEntry
+	var pendingKey string
+	var lines []string
+	var last *sdjournal.JournalEntry
+	// Whether any line of the pending message is marked with TruncatedField.
+	var truncated bool
+
+	timer := time.NewTimer(a.timeout)
+	timer.Stop()
+	resetTimer := func() {
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(a.timeout)
+	}
+
+	// Incomplete lines of containers are delivered after one to two timeouts.
+	ticker := time.NewTicker(a.timeout)
+	defer ticker.Stop()
+
+	// flush delivers the pending message, and returns false if the ctx is canceled before that.
+	flush := func() bool {
+		if pending == nil {
+			return true
+		}
+		entry := merge(pending, last, lines, truncated)
+		pending, last, lines, truncated = nil, nil, nil, false
+		return a.send(ctx, entry)
+	}
+
+	// add merges the complete line into the pending message or delivers it, and returns false if the ctx is canceled.
+	add := func(entry *sdjournal.JournalEntry) bool {
+		key, ok := a.key(entry)
+		message := entry.Fields[sdjournal.SD_JOURNAL_FIELD_MESSAGE]
+		if pending != nil && ok && key == pendingKey && len(lines) < a.maxLines && a.continues(message) {
+			lines = append(lines, message)
+			last = entry
+			truncated = truncated || entry.Fields[TruncatedField] == "true"
+			resetTimer()
+			return true
+		}
+		if !flush() {
+			return false
+		}
+		if !ok || a.start == nil && a.continuation == nil {
+			return a.send(ctx, entry)
+		}
+		pending, pendingKey, lines, last = entry, key, []string{message}, entry
+		truncated = entry.Fields[TruncatedField] == "true"
+		resetTimer()
+		return true
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			if !flush() {
+				return
+			}
+		case now := <-ticker.C:
+			for _, entry := range a.partials.expired(now, a.timeout) {
+				if !add(entry) {
+					return
+				}
+			}
+		case entry, ok := <-a.entries:
+			if !ok {
+				// The input ended, e.g. an export is read to its end. Nothing completes the pending lines any more.
+				for _, entry := range a.partials.expired(time.Now(), 0) {
+					if !add(entry) {
+						return
+					}
+				}
+				if flush() {
+					close(a.assembled)
+				}
+				return
+			}
+			if entry = a.partials.add(a.markTruncated(entry), time.Now()); entry == nil {
+				continue
+			}
+			if !add(entry) {
+				return
+			}
+		}
+	}
+}
+
+// markTruncated returns the entry marked with TruncatedField if its MESSAGE reaches the data threshold. journald cuts
+// the message at the threshold, which can be in the middle of a character, so the cut character is trimmed to keep
+// the message text. The entry is not modified.
+func (a *Assembler) markTruncated(entry *sdjournal.JournalEntry) *sdjournal.JournalEntry {
+	message, ok := entry.Fields[sdjournal.SD_JOURNAL_FIELD_MESSAGE]
+	// The threshold applies to the whole "MESSAGE=<message>" data field.
+	if !ok || a.dataThreshold <= 0 || len("MESSAGE=")+len(message) < a.dataThreshold {
+		return entry
+	}
+	marked := *entry
+	marked.Fields = maps.Clone(entry.Fields)
+	marked.Fields[sdjournal.SD_JOURNAL_FIELD_MESSAGE] = trimPartialRune(message)
+	marked.Fields[TruncatedField] = "true"
+	return &marked
+}
+
+// trimPartialRune returns s without the UTF-8 character at its end that is cut in the middle, if any.
+func trimPartialRune(s string) string {
+	for i := len(s) - 1; i >= 0 && i >= len(s)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(s[i]) {
+			if !utf8.FullRuneInString(s[i:]) {
+				return s[:i]
+			}
+			return s
+		}
+	}
+	return s
+}
+
+// key returns the unit, PID and container of the entry, and false if the entry is not merged. Entries of all
+// containers have the unit and PID of the container engine.
+func (a *Assembler) key(entry *sdjournal.JournalEntry) (string, bool) {
+	if _, ok := entry.Fields[sdjournal.SD_JOURNAL_FIELD_MESSAGE]; !ok {
+		return "", false
+	}
+	if _, ok := entry.Fields[GapFromField]; ok {
+		return "", false
+	}
+	unit := entry.Fields[sdjournal.SD_JOURNAL_FIELD_SYSTEMD_UNIT]
+	if unit == "" {
+		unit = entry.Fields[sdjournal.SD_JOURNAL_FIELD_SYSLOG_IDENTIFIER]
+	}
+	if len(a.units) > 0 && !slices.Contains(a.units, unit) {
+		return "", false
+	}
+	return unit + "\x00" + entry.Fields[sdjournal.SD_JOURNAL_FIELD_PID] + "\x00" + entry.Fields[containerIDField], true
+}
+
+// continues tells whether the line continues the message before it.
+func (a *Assembler) continues(line string) bool {
+	if a.continuation != nil && a.continuation.MatchString(line) {
+		return true
+	}
+	return a.start != nil && !a.start.MatchString(line)
+}
+
+// send puts the entry to the channel, and returns false if the ctx is canceled before that.
+func (a *Assembler) send(ctx context.Context, entry *sdjournal.JournalEntry) bool {
+	select {
+	case a.assembled <- entry:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// merge returns the first entry with the lines as MESSAGE and the cursor of the last entry, including the cursor in
+// EntryCursorField, if any. It is marked with TruncatedField if any line is. The first entry is not modified.
+func merge(first, last *sdjournal.JournalEntry, lines []string, truncated bool) *sdjournal.JournalEntry {
+	if len(lines) == 1 {
+		return first
+	}
+	merged := *first
+	merged.Fields = make(map[string]string, len(first.Fields))
+	for k, v := range first.Fields {
+		merged.Fields[k] = v
+	}
+	merged.Fields[sdjournal.SD_JOURNAL_FIELD_MESSAGE] = strings.Join(lines, "\n")
+	merged.Cursor = last.Cursor
+	if cursor, ok := last.Fields[EntryCursorField]; ok {
+		merged.Fields[EntryCursorField] = cursor
+	} else {
+		delete(merged.Fields, EntryCursorField)
+	}
+	if truncated {
+		merged.Fields[TruncatedField] = "true"
+	}
+	return &merged
+}
+
+type AssemblerOption func(*Assembler)
+
+// WithStartPattern sets the pattern of the first line of a message. Lines that do not match it continue the message.
+func WithStartPattern(start *regexp.Regexp) AssemblerOption {
+	return func(a *Assembler) {
+		a.start = start
+	}
+}
+
+// WithContinuationPattern sets the pattern of lines that continue the message before them.
+func WithContinuationPattern(continuation *regexp.Regexp) AssemblerOption {
+	return func(a *Assembler) {
+		a.continuation = continuation
+	}
+}
+
+// WithMultilineUnits merges only entries of the units, by _SYSTEMD_UNIT or SYSLOG_IDENTIFIER.
+func WithMultilineUnits(units ...string) AssemblerOption {
+	return func(a *Assembler) {
+		a.units = units
+	}
+}
+
+// WithMultilineTimeout sets the time to wait for the next line before delivering a message.
+func WithMultilineTimeout(timeout time.Duration) AssemblerOption {
+	return func(a *Assembler) {
+		a.timeout = timeout
+	}
+}
+
+// WithDataThreshold marks entries whose MESSAGE reaches the data threshold of the journal with TruncatedField, see
+// sd_journal_set_data_threshold(3).
+func WithDataThreshold(threshold int) AssemblerOption {
+	return func(a *Assembler) {
+		a.dataThreshold = threshold
+	}
+}
+
+// WithMultilineMaxLines sets the maximum number of lines of one message.
+func WithMultilineMaxLines(n int) AssemblerOption {
+	return func(a *Assembler) {
+		a.maxLines = n
+	}
+}
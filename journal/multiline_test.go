@@ -0,0 +1,234 @@
+package journal
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/sdjournal"
+	"github.com/stretchr/testify/assert"
+)
+
+func line(i int, unit, pid, message string) *sdjournal.JournalEntry {
+	return &sdjournal.JournalEntry{
+		Cursor: fmt.Sprintf("cursor-%d", i),
+		Fields: map[string]string{
+			sdjournal.SD_JOURNAL_FIELD_SYSTEMD_UNIT: unit,
+			sdjournal.SD_JOURNAL_FIELD_PID:          pid,
+			sdjournal.SD_JOURNAL_FIELD_MESSAGE:      message,
+		},
+	}
+}
+
+// assemble sends the entries to an assembler and returns the first n assembled entries.
+func assemble(
+	t *testing.T,
+	entries []*sdjournal.JournalEntry,
+	n int,
+	opts ...AssemblerOption,
+) []*sdjournal.JournalEntry {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	in := make(chan *sdjournal.JournalEntry)
+	a := NewAssembler(in, append([]AssemblerOption{WithMultilineTimeout(10 * time.Millisecond)}, opts...)...)
+	go a.Assemble(ctx)
+	go func() {
+		for _, e := range entries {
+			in <- e
+		}
+	}()
+	var assembled []*sdjournal.JournalEntry
+	for i := 0; i < n; i++ {
+		select {
+		case e := <-a.Entries():
+			assembled = append(assembled, e)
+		case <-time.After(time.Second):
+			t.Fatalf("got %d of %d entries", i, n)
+		}
+	}
+	return assembled
+}
+
+func messages(entries []*sdjournal.JournalEntry) []string {
+	var m []string
+	for _, e := range entries {
+		m = append(m, e.Fields[sdjournal.SD_JOURNAL_FIELD_MESSAGE])
+	}
+	return m
+}
+
+func cursors(entries []*sdjournal.JournalEntry) []string {
+	var c []string
+	for _, e := range entries {
+		c = append(c, e.Cursor)
+	}
+	return c
+}
+
+func TestAssembleStartPattern(t *testing.T) {
+	entries := []*sdjournal.JournalEntry{
+		line(0, "app.service", "1", "2024-10-01 ERROR failed"),
+		line(1, "app.service", "1", "java.lang.IllegalStateException: boom"),
+		line(2, "app.service", "1", "\tat App.main(App.java:1)"),
+		line(3, "app.service", "1", "2024-10-01 INFO next"),
+	}
+	assembled := assemble(t, entries, 2, WithStartPattern(regexp.MustCompile(`^\d{4}-`)))
+	assert.Equal(t, []string{
+		"2024-10-01 ERROR failed\njava.lang.IllegalStateException: boom\n\tat App.main(App.java:1)",
+		"2024-10-01 INFO next",
+	}, messages(assembled))
+	assert.Equal(t, []string{"cursor-2", "cursor-3"}, cursors(assembled))
+	// The entries are not modified.
+	assert.Equal(t, "2024-10-01 ERROR failed", entries[0].Fields[sdjournal.SD_JOURNAL_FIELD_MESSAGE])
+	assert.Equal(t, "cursor-0", entries[0].Cursor)
+}
+
+func TestAssembleContinuationPattern(t *testing.T) {
+	entries := []*sdjournal.JournalEntry{
+		line(0, "app.service", "1", "Traceback (most recent call last):"),
+		line(1, "app.service", "1", `  File "app.py", line 1`),
+		line(2, "app.service", "1", "ValueError: boom"),
+	}
+	assembled := assemble(t, entries, 2, WithContinuationPattern(regexp.MustCompile(`^\s`)))
+	assert.Equal(t, []string{
+		"Traceback (most recent call last):\n  File \"app.py\", line 1",
+		"ValueError: boom",
+	}, messages(assembled))
+	assert.Equal(t, []string{"cursor-1", "cursor-2"}, cursors(assembled))
+}
+
+func TestAssembleOnlyConsecutiveLinesOfSameProcess(t *testing.T) {
+	entries := []*sdjournal.JournalEntry{
+		line(0, "app.service", "1", "start"),
+		line(1, "app.service", "2", " other pid"),
+		line(2, "other.service", "2", " other unit"),
+		line(3, "app.service", "1", " not consecutive"),
+	}
+	assembled := assemble(t, entries, 4, WithContinuationPattern(regexp.MustCompile(`^\s`)))
+	assert.Equal(t, []string{"start", " other pid", " other unit", " not consecutive"}, messages(assembled))
+}
+
+func TestAssembleUnits(t *testing.T) {
+	entries := []*sdjournal.JournalEntry{
+		line(0, "other.service", "1", "start"),
+		line(1, "other.service", "1", " continued"),
+		line(2, "app.service", "1", "start"),
+		line(3, "app.service", "1", " continued"),
+	}
+	assembled := assemble(t, entries, 3, WithContinuationPattern(regexp.MustCompile(`^\s`)),
+		WithMultilineUnits("app.service"))
+	assert.Equal(t, []string{"start", " continued", "start\n continued"}, messages(assembled))
+}
+
+func TestAssembleMaxLines(t *testing.T) {
+	entries := []*sdjournal.JournalEntry{
+		line(0, "app.service", "1", "a"),
+		line(1, "app.service", "1", " b"),
+		line(2, "app.service", "1", " c"),
+	}
+	assembled := assemble(t, entries, 2, WithContinuationPattern(regexp.MustCompile(`^\s`)),
+		WithMultilineMaxLines(2))
+	assert.Equal(t, []string{"a\n b", " c"}, messages(assembled))
+}
+
+func TestAssembleFlushesAfterTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	in := make(chan *sdjournal.JournalEntry)
+	a := NewAssembler(in, WithContinuationPattern(regexp.MustCompile(`^\s`)),
+		WithMultilineTimeout(10*time.Millisecond))
+	go a.Assemble(ctx)
+
+	in <- line(0, "app.service", "1", "a")
+	in <- line(1, "app.service", "1", " b")
+	// No line follows, so the message is delivered after the timeout.
+	select {
+	case e := <-a.Entries():
+		assert.Equal(t, "a\n b", e.Fields[sdjournal.SD_JOURNAL_FIELD_MESSAGE])
+		assert.Equal(t, "cursor-1", e.Cursor)
+	case <-time.After(time.Second):
+		t.Fatal("message is not flushed")
+	}
+}
+
+func TestAssembleFlushesWhenInputEnds(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	in := make(chan *sdjournal.JournalEntry)
+	a := NewAssembler(in, WithContinuationPattern(regexp.MustCompile(`^\s`)), WithMultilineTimeout(time.Minute))
+	go a.Assemble(ctx)
+
+	in <- line(0, "app.service", "1", "a")
+	in <- line(1, "app.service", "1", " b")
+	close(in)
+	var assembled []*sdjournal.JournalEntry
+	for e := range a.Entries() {
+		assembled = append(assembled, e)
+	}
+	assert.Equal(t, []string{"a\n b"}, messages(assembled))
+	assert.Equal(t, []string{"cursor-1"}, cursors(assembled))
+}
+
+func TestAssemblePassesThroughWithoutPatterns(t *testing.T) {
+	entries := []*sdjournal.JournalEntry{
+		line(0, "app.service", "1", "a"),
+		line(1, "app.service", "1", " b"),
+	}
+	assembled := assemble(t, entries, 2)
+	assert.Equal(t, entries, assembled)
+}
+
+// TestMergeEntryCursor tests that a merged entry is told from other entries by the cursor of its last entry, even if
+// the last entry is delivered with the cursor of an earlier entry, see partialMessages.
+func TestMergeEntryCursor(t *testing.T) {
+	first := &sdjournal.JournalEntry{Cursor: "c1", Fields: map[string]string{"MESSAGE": "a", EntryCursorField: "c2"}}
+	last := &sdjournal.JournalEntry{Cursor: "c1", Fields: map[string]string{"MESSAGE": "b", EntryCursorField: "c3"}}
+	merged := merge(first, last, []string{"a", "b"}, false)
+	assert.Equal(t, "c1", merged.Cursor)
+	assert.Equal(t, "c3", EntryCursor(merged))
+
+	last = &sdjournal.JournalEntry{Cursor: "c4", Fields: map[string]string{"MESSAGE": "b"}}
+	merged = merge(first, last, []string{"a", "b"}, false)
+	assert.Equal(t, "c4", merged.Cursor)
+	assert.Equal(t, "c4", EntryCursor(merged))
+}
+
+func TestAssembleWithDataThreshold(t *testing.T) {
+	entries := []*sdjournal.JournalEntry{
+		line(1, "a.service", "1", "short"),
+		line(2, "a.service", "1", "long message"),
+		// journald cut the second character in the middle.
+		line(3, "a.service", "1", "long é\xc3"),
+	}
+	assembled := assemble(t, entries, 3, WithDataThreshold(len("MESSAGE=")+8))
+	assert.Equal(t, []string{"short", "long message", "long é"}, messages(assembled))
+	var truncated []string
+	for _, e := range assembled {
+		truncated = append(truncated, e.Fields[TruncatedField])
+	}
+	assert.Equal(t, []string{"", "true", "true"}, truncated)
+	// The entries are not modified.
+	assert.NotContains(t, entries[1].Fields, TruncatedField)
+}
+
+// TestAssembleMultilineWithDataThreshold tests that a message merged from lines under the data threshold is not marked
+// as truncated, however long it is, and that a message with a line that reaches the threshold is.
+func TestAssembleMultilineWithDataThreshold(t *testing.T) {
+	start := regexp.MustCompile(`^\S`)
+	var entries []*sdjournal.JournalEntry
+	entries = append(entries, line(1, "a.service", "1", "panic: oops"))
+	for i := 2; i < 10; i++ {
+		entries = append(entries, line(i, "a.service", "1", "\tat frame"))
+	}
+	entries = append(entries, line(10, "a.service", "1", "panic: again"))
+	entries = append(entries, line(11, "a.service", "1", "\tat a frame that is cut"))
+	entries = append(entries, line(12, "a.service", "1", "next"))
+
+	assembled := assemble(t, entries, 2, WithStartPattern(start), WithDataThreshold(len("MESSAGE=")+16))
+	assert.Greater(t, len(assembled[0].Fields["MESSAGE"]), 16)
+	assert.NotContains(t, assembled[0].Fields, TruncatedField)
+	assert.Equal(t, "panic: again\n\tat a frame that is cut", assembled[1].Fields["MESSAGE"])
+	assert.Equal(t, "true", assembled[1].Fields[TruncatedField])
+}
@@ -0,0 +1,51 @@
+package journal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultJournalDirs are where journald stores persistent and volatile journals, in order of preference.
+var DefaultJournalDirs = []string{"/var/log/journal", "/run/log/journal"}
+
+// Namespaces returns the sorted names of journal namespaces of the machine found in the given journal directories. The
+// journals of a namespace are stored in "<dir>/<machine-id>.<namespace>".
+func Namespaces(dirs []string, machineID string) ([]string, error) {
+	seen := make(map[string]bool)
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot list journal directory %s, %w", dir, err)
+		}
+		for _, e := range entries {
+			ns, ok := strings.CutPrefix(e.Name(), machineID+".")
+			if e.IsDir() && ok && ns != "" {
+				seen[ns] = true
+			}
+		}
+	}
+	namespaces := make([]string, 0, len(seen))
+	for ns := range seen {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
+
+// NamespaceDir returns the first of the given journal directories that has journals of the namespace. Persistent
+// journals are preferred when the dirs are in the order of DefaultJournalDirs.
+func NamespaceDir(dirs []string, machineID, namespace string) (string, error) {
+	for _, dir := range dirs {
+		path := filepath.Join(dir, machineID+"."+namespace)
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("cannot find journal directory of namespace %s in %v", namespace, dirs)
+}
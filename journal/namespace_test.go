@@ -0,0 +1,40 @@
+package journal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var dummyMachineID = "ec22e31111111111111111111111115b"
+
+func TestNamespaces(t *testing.T) {
+	persistent, volatile := t.TempDir(), t.TempDir()
+	for _, dir := range []string{
+		filepath.Join(persistent, dummyMachineID),
+		filepath.Join(persistent, dummyMachineID+".foo"),
+		filepath.Join(volatile, dummyMachineID+".bar"),
+		filepath.Join(volatile, dummyMachineID+".foo"),
+		filepath.Join(volatile, "a1111111111111111111111111111111.other"),
+	} {
+		assert.NoError(t, os.Mkdir(dir, 0700))
+	}
+	dirs := []string{persistent, volatile, filepath.Join(persistent, "non-exist")}
+
+	namespaces, err := Namespaces(dirs, dummyMachineID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bar", "foo"}, namespaces)
+
+	dir, err := NamespaceDir(dirs, dummyMachineID, "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(persistent, dummyMachineID+".foo"), dir)
+
+	dir, err = NamespaceDir(dirs, dummyMachineID, "bar")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(volatile, dummyMachineID+".bar"), dir)
+
+	_, err = NamespaceDir(dirs, dummyMachineID, "baz")
+	assert.Error(t, err)
+}
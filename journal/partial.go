@@ -0,0 +1,184 @@
+package journal
+
+import (
+	"maps"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/sdjournal"
+)
+
+// Fields of Docker's journald log driver, which splits lines longer than 16 KB into several entries. All entries but
+// the last have CONTAINER_PARTIAL_MESSAGE=true. Newer versions also set CONTAINER_PARTIAL_ID, the same for all entries
+// of a line, and CONTAINER_PARTIAL_LAST=true on the last one.
+const (
+	containerIDField     = "CONTAINER_ID"
+	containerIDFullField = "CONTAINER_ID_FULL"
+	partialMessageField  = "CONTAINER_PARTIAL_MESSAGE"
+	partialIDField       = "CONTAINER_PARTIAL_ID"
+	partialOrdinalField  = "CONTAINER_PARTIAL_ORDINAL"
+	partialLastField     = "CONTAINER_PARTIAL_LAST"
+)
+
+// maxPartialMessageSize is the size to deliver an incomplete line at, which is far beyond the size of a log event.
+const maxPartialMessageSize = 1024 * 1024
+
+// EntryCursorField keeps the cursor of an entry that is delivered with the cursor of an earlier entry, see
+// partialMessages. The cursor of a delivered entry is where to resume reading once the entry is shipped.
+const EntryCursorField = "JOURNALD_TO_CWL_ENTRY_CURSOR"
+
+// EntryCursor returns the cursor of the entry itself, which tells it from other entries, see EntryCursorField.
+func EntryCursor(entry *sdjournal.JournalEntry) string {
+	if cursor, ok := entry.Fields[EntryCursorField]; ok {
+		return cursor
+	}
+	return entry.Cursor
+}
+
+// partialMessage is a line of a container that is not complete yet.
+type partialMessage struct {
+	first *sdjournal.JournalEntry
+	last  *sdjournal.JournalEntry
+	parts []string
+	size  int
+
+	// truncated is set if any part is marked with TruncatedField.
+	truncated bool
+
+	// seq orders partial messages by their first entry, updated is when the last entry is added.
+	seq     uint64
+	updated time.Time
+
+	// before is the cursor of the entry read before the first entry.
+	before string
+}
+
+// partialMessages reassembles the lines that Docker's journald log driver splits, by container and stream. Lines of
+// different containers can be interleaved, so entries after the first part of a line may be delivered before the line.
+// While a line is pending, entries are delivered with the cursor of the entry before the oldest pending line, and the
+// entry's own cursor in EntryCursorField, so the saved cursor does not move past the parts of the line. If
+// journald-to-cwl stops then, the line is read again as a whole, and so are the entries delivered before it. The
+// cursors of delivered entries never go back.
+type partialMessages struct {
+	pending map[string]*partialMessage
+	seq     uint64
+
+	// read is the cursor of the last entry added.
+	read string
+}
+
+// add adds the entry and returns the complete line if the entry completes it, or the entry itself if it is not part of
+// a split line. It returns nil if the line is not complete yet.
+func (p *partialMessages) add(entry *sdjournal.JournalEntry, now time.Time) *sdjournal.JournalEntry {
+	before := p.read
+	p.read = entry.Cursor
+	key, ok := partialKey(entry)
+	if !ok {
+		return p.resumable(entry)
+	}
+	partial := entry.Fields[partialMessageField] == "true" && entry.Fields[partialLastField] != "true"
+	m := p.pending[key]
+	if m == nil {
+		if !partial {
+			return p.resumable(entry)
+		}
+		if p.pending == nil {
+			p.pending = make(map[string]*partialMessage)
+		}
+		p.seq++
+		m = &partialMessage{first: entry, seq: p.seq, before: before}
+		p.pending[key] = m
+	}
+	message := entry.Fields[sdjournal.SD_JOURNAL_FIELD_MESSAGE]
+	m.parts = append(m.parts, message)
+	m.size += len(message)
+	m.truncated = m.truncated || entry.Fields[TruncatedField] == "true"
+	m.last = entry
+	m.updated = now
+	if partial && m.size < maxPartialMessageSize {
+		return nil
+	}
+	delete(p.pending, key)
+	return p.resumable(m.merge())
+}
+
+// expired returns the lines that got no entry for the timeout, in the order of their first entries. A line is
+// incomplete if, e.g., the container stopped while writing it.
+func (p *partialMessages) expired(now time.Time, timeout time.Duration) []*sdjournal.JournalEntry {
+	var expired []*partialMessage
+	for key, m := range p.pending {
+		if now.Sub(m.updated) >= timeout {
+			expired = append(expired, m)
+			delete(p.pending, key)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool {
+		return expired[i].seq < expired[j].seq
+	})
+	entries := make([]*sdjournal.JournalEntry, 0, len(expired))
+	for _, m := range expired {
+		entries = append(entries, p.resumable(m.merge()))
+	}
+	return entries
+}
+
+// resumable returns the entry with the cursor to resume reading at once the entry is delivered. It is the cursor of the
+// entry before the oldest pending line, or the cursor of the last entry read if no line is pending. If it is not the
+// cursor of the entry, the entry is copied with its cursor in EntryCursorField.
+func (p *partialMessages) resumable(entry *sdjournal.JournalEntry) *sdjournal.JournalEntry {
+	cursor := p.read
+	var oldest *partialMessage
+	for _, m := range p.pending {
+		if oldest == nil || m.seq < oldest.seq {
+			oldest = m
+		}
+	}
+	if oldest != nil {
+		cursor = oldest.before
+	}
+	if entry.Cursor == cursor {
+		return entry
+	}
+	resumed := *entry
+	resumed.Fields = maps.Clone(entry.Fields)
+	resumed.Fields[EntryCursorField] = EntryCursor(entry)
+	resumed.Cursor = cursor
+	return &resumed
+}
+
+// merge returns the first entry with the parts joined as MESSAGE, without the partial message fields, and the cursor
+// of the last entry. It is marked with TruncatedField if any part is. The entries are not modified.
+func (m *partialMessage) merge() *sdjournal.JournalEntry {
+	merged := *m.first
+	merged.Fields = make(map[string]string, len(m.first.Fields))
+	for k, v := range m.first.Fields {
+		switch k {
+		case partialMessageField, partialIDField, partialOrdinalField, partialLastField, TruncatedField:
+		default:
+			merged.Fields[k] = v
+		}
+	}
+	merged.Fields[sdjournal.SD_JOURNAL_FIELD_MESSAGE] = strings.Join(m.parts, "")
+	if m.truncated {
+		merged.Fields[TruncatedField] = "true"
+	}
+	merged.Cursor = m.last.Cursor
+	return &merged
+}
+
+// partialKey returns the key of the line the entry belongs to, and false if the entry is not from a container.
+func partialKey(entry *sdjournal.JournalEntry) (string, bool) {
+	if id, ok := entry.Fields[partialIDField]; ok {
+		return id, true
+	}
+	id := entry.Fields[containerIDFullField]
+	if id == "" {
+		id = entry.Fields[containerIDField]
+	}
+	if id == "" {
+		return "", false
+	}
+	// stdout and stderr are logged with different priorities.
+	return id + "\x00" + entry.Fields[sdjournal.SD_JOURNAL_FIELD_PRIORITY], true
+}
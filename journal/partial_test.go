@@ -0,0 +1,154 @@
+package journal
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/sdjournal"
+	"github.com/stretchr/testify/assert"
+)
+
+func containerLine(cursor, id, message string, partial bool) *sdjournal.JournalEntry {
+	e := &sdjournal.JournalEntry{
+		Cursor: cursor,
+		Fields: map[string]string{
+			containerIDField:                    id,
+			sdjournal.SD_JOURNAL_FIELD_PRIORITY: "6",
+			sdjournal.SD_JOURNAL_FIELD_MESSAGE:  message,
+		},
+	}
+	if partial {
+		e.Fields[partialMessageField] = "true"
+	}
+	return e
+}
+
+func TestPartialMessages(t *testing.T) {
+	var p partialMessages
+	now := time.Now()
+
+	// An entry that is not from a container or not partial is complete.
+	plain := &sdjournal.JournalEntry{Cursor: "c0", Fields: map[string]string{"MESSAGE": "plain"}}
+	assert.Same(t, plain, p.add(plain, now))
+	whole := containerLine("c1", "a", "whole", false)
+	assert.Same(t, whole, p.add(whole, now))
+
+	// Lines of different containers are interleaved.
+	assert.Nil(t, p.add(containerLine("c2", "a", "a1-", true), now))
+	assert.Nil(t, p.add(containerLine("c3", "b", "b1-", true), now))
+	assert.Nil(t, p.add(containerLine("c4", "a", "a2-", true), now))
+	b := p.add(containerLine("c5", "b", "b2", false), now)
+	assert.Equal(t, "b1-b2", b.Fields["MESSAGE"])
+	// The line of a is pending, so the cursor does not move past its first part.
+	assert.Equal(t, "c1", b.Cursor)
+	assert.Equal(t, "c5", EntryCursor(b))
+	_, ok := b.Fields[partialMessageField]
+	assert.False(t, ok)
+	a := p.add(containerLine("c6", "a", "a3", false), now)
+	assert.Equal(t, "a1-a2-a3", a.Fields["MESSAGE"])
+	assert.Equal(t, "c6", a.Cursor)
+	assert.Equal(t, "c6", EntryCursor(a))
+	assert.Empty(t, p.pending)
+}
+
+// TestPartialMessagesHoldCursor tests that entries delivered while a line is pending have the cursor of the entry
+// before the line, and that the cursors of delivered entries never go back.
+func TestPartialMessagesHoldCursor(t *testing.T) {
+	var p partialMessages
+	now := time.Now()
+	plain := func(cursor string) *sdjournal.JournalEntry {
+		return &sdjournal.JournalEntry{Cursor: cursor, Fields: map[string]string{"MESSAGE": cursor}}
+	}
+
+	first := plain("c0")
+	assert.Same(t, first, p.add(first, now))
+	assert.Nil(t, p.add(containerLine("c1", "a", "a1-", true), now))
+	held := p.add(plain("c2"), now)
+	assert.Equal(t, "c0", held.Cursor)
+	assert.Equal(t, "c2", EntryCursor(held))
+	assert.Nil(t, p.add(containerLine("c3", "b", "b1-", true), now.Add(time.Second)))
+	held = p.add(plain("c4"), now)
+	assert.Equal(t, "c0", held.Cursor)
+
+	// The line of a expires, so the cursor moves to the entry before the line of b.
+	expired := p.expired(now.Add(1500*time.Millisecond), time.Second)
+	assert.Len(t, expired, 1)
+	assert.Equal(t, "c2", expired[0].Cursor)
+	assert.Equal(t, "c1", EntryCursor(expired[0]))
+	held = p.add(plain("c5"), now)
+	assert.Equal(t, "c2", held.Cursor)
+
+	// No line is pending after the line of b expires, so its cursor is the last entry read, not its own.
+	expired = p.expired(now.Add(3*time.Second), time.Second)
+	assert.Len(t, expired, 1)
+	assert.Equal(t, "c5", expired[0].Cursor)
+	assert.Equal(t, "c3", EntryCursor(expired[0]))
+	last := plain("c6")
+	assert.Same(t, last, p.add(last, now))
+}
+
+func TestPartialMessagesWithPartialID(t *testing.T) {
+	var p partialMessages
+	now := time.Now()
+	first := containerLine("c1", "a", "x-", true)
+	first.Fields[partialIDField] = "p1"
+	first.Fields[partialOrdinalField] = "1"
+	last := containerLine("c2", "a", "y", true)
+	last.Fields[partialIDField] = "p1"
+	last.Fields[partialOrdinalField] = "2"
+	last.Fields[partialLastField] = "true"
+
+	assert.Nil(t, p.add(first, now))
+	merged := p.add(last, now)
+	assert.Equal(t, "x-y", merged.Fields["MESSAGE"])
+	for _, f := range []string{partialIDField, partialOrdinalField, partialLastField} {
+		_, ok := merged.Fields[f]
+		assert.False(t, ok, f)
+	}
+}
+
+func TestPartialMessagesExpired(t *testing.T) {
+	var p partialMessages
+	now := time.Now()
+	assert.Nil(t, p.add(containerLine("c1", "a", "a1", true), now))
+	assert.Nil(t, p.add(containerLine("c2", "b", "b1", true), now.Add(time.Second)))
+
+	assert.Empty(t, p.expired(now.Add(time.Second), 2*time.Second))
+	expired := p.expired(now.Add(2500*time.Millisecond), 2*time.Second)
+	assert.Len(t, expired, 1)
+	assert.Equal(t, "a1", expired[0].Fields["MESSAGE"])
+	assert.Equal(t, "c1", expired[0].Cursor)
+	assert.Len(t, p.pending, 1)
+}
+
+// TestAssembleContainerPartialMessagesWithDataThreshold tests that a line made of parts under the data threshold is not
+// marked as truncated, however long it is, and that a line with a part that reaches the threshold is.
+func TestAssembleContainerPartialMessagesWithDataThreshold(t *testing.T) {
+	part := strings.Repeat("a", 16)
+	entries := []*sdjournal.JournalEntry{
+		containerLine("c1", "a", part, true),
+		containerLine("c2", "a", part, true),
+		containerLine("c3", "a", part, false),
+		containerLine("c4", "b", part, true),
+		// journald cut the second character in the middle.
+		containerLine("c5", "b", part[2:]+"\u00e9\xc3", false),
+	}
+	assembled := assemble(t, entries, 2, WithDataThreshold(len("MESSAGE=")+len(part)+1))
+	assert.Equal(t, []string{part + part + part, part + part[2:] + "\u00e9"}, messages(assembled))
+	_, ok := assembled[0].Fields[TruncatedField]
+	assert.False(t, ok)
+	assert.Equal(t, "true", assembled[1].Fields[TruncatedField])
+}
+
+func TestAssembleContainerPartialMessages(t *testing.T) {
+	entries := []*sdjournal.JournalEntry{
+		containerLine("c1", "a", "a1-", true),
+		containerLine("c2", "a", "a2", false),
+		containerLine("c3", "a", " continued", false),
+	}
+	assembled := assemble(t, entries, 1, WithContinuationPattern(regexp.MustCompile(`^\s`)))
+	assert.Equal(t, []string{"a1-a2\n continued"}, messages(assembled))
+	assert.Equal(t, []string{"c3"}, cursors(assembled))
+}
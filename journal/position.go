@@ -0,0 +1,69 @@
+package journal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Position is the position of an entry in the journal, parsed from its cursor. A journald cursor looks like
+// "s=<seqnum id>;i=<seqnum>;b=<boot id>;m=<monotonic>;t=<realtime>;x=<xor hash>", where numbers are in hex. Cursors
+// are opaque in the sd-journal API, so use Position only for estimates, e.g. whether an entry comes after another.
+type Position struct {
+	SeqnumID string
+	Seqnum   uint64
+
+	BootID    string
+	Monotonic uint64
+
+	// Realtime is the realtime timestamp in microseconds.
+	Realtime uint64
+}
+
+// ParseCursor parses the position from a journald cursor.
+func ParseCursor(cursor string) (Position, error) {
+	var p Position
+	var hasSeqnum, hasRealtime bool
+	for _, kv := range strings.Split(cursor, ";") {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return Position{}, fmt.Errorf("invalid cursor %q", cursor)
+		}
+		var err error
+		switch k {
+		case "s":
+			p.SeqnumID = v
+		case "i":
+			p.Seqnum, err = strconv.ParseUint(v, 16, 64)
+			hasSeqnum = true
+		case "b":
+			p.BootID = v
+		case "m":
+			p.Monotonic, err = strconv.ParseUint(v, 16, 64)
+		case "t":
+			p.Realtime, err = strconv.ParseUint(v, 16, 64)
+			hasRealtime = true
+		}
+		if err != nil {
+			return Position{}, fmt.Errorf("invalid cursor %q, %w", cursor, err)
+		}
+	}
+	if !(p.SeqnumID != "" && hasSeqnum) && !hasRealtime {
+		return Position{}, fmt.Errorf("invalid cursor %q, neither seqnum nor realtime", cursor)
+	}
+	return p, nil
+}
+
+// String formats the position as a journald cursor. The xor hash is not known and is always 0.
+func (p Position) String() string {
+	return fmt.Sprintf("s=%s;i=%x;b=%s;m=%x;t=%x;x=0", p.SeqnumID, p.Seqnum, p.BootID, p.Monotonic, p.Realtime)
+}
+
+// After tells whether the entry at p comes after the entry at q. Seqnums are compared if both come from the same
+// seqnum id, i.e. the same journal writer, otherwise realtime timestamps are compared.
+func (p Position) After(q Position) bool {
+	if p.SeqnumID != "" && p.SeqnumID == q.SeqnumID {
+		return p.Seqnum > q.Seqnum
+	}
+	return p.Realtime > q.Realtime
+}
@@ -0,0 +1,73 @@
+package journal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var dummyCursor = "s=f4c4c1111111111111111111111111e2;i=1a2b;b=f595e6391111111111111111372bf520;" +
+	"m=d1134a5b0a;t=61ec1a96c1f31;x=1f0c8e1111111111"
+
+func TestParseCursor(t *testing.T) {
+	p, err := ParseCursor(dummyCursor)
+	assert.NoError(t, err)
+	assert.Equal(t, Position{
+		SeqnumID:  "f4c4c1111111111111111111111111e2",
+		Seqnum:    0x1a2b,
+		BootID:    "f595e6391111111111111111372bf520",
+		Monotonic: 0xd1134a5b0a,
+		Realtime:  0x61ec1a96c1f31,
+	}, p)
+
+	q, err := ParseCursor(p.String())
+	assert.NoError(t, err)
+	assert.Equal(t, p, q)
+}
+
+func TestParseCursor_Invalid(t *testing.T) {
+	for _, cursor := range []string{"", "cursor-0", "s=abc", "s=abc;i=xyz", "t=xyz"} {
+		_, err := ParseCursor(cursor)
+		assert.Error(t, err, cursor)
+	}
+}
+
+func TestPositionAfter(t *testing.T) {
+	cases := []struct {
+		name     string
+		p        Position
+		q        Position
+		expected bool
+	}{
+		{
+			"same seqnum id, bigger seqnum",
+			Position{SeqnumID: "a", Seqnum: 2, Realtime: 1},
+			Position{SeqnumID: "a", Seqnum: 1, Realtime: 2},
+			true,
+		},
+		{
+			"same seqnum id, same seqnum",
+			Position{SeqnumID: "a", Seqnum: 1},
+			Position{SeqnumID: "a", Seqnum: 1},
+			false,
+		},
+		{
+			"different seqnum id, later",
+			Position{SeqnumID: "a", Seqnum: 1, Realtime: 2},
+			Position{SeqnumID: "b", Seqnum: 2, Realtime: 1},
+			true,
+		},
+		{
+			"different seqnum id, earlier",
+			Position{SeqnumID: "a", Seqnum: 2, Realtime: 1},
+			Position{SeqnumID: "b", Seqnum: 1, Realtime: 2},
+			false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.p.After(tc.q))
+		})
+	}
+}
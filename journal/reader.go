@@ -3,11 +3,27 @@ package journal
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/coreos/go-systemd/v22/sdjournal"
+	"go.uber.org/zap"
 )
 
+const (
+	defaultMaxFailures = 10
+
+	defaultMinBackoff = 100 * time.Millisecond
+
+	defaultMaxBackoff = 30 * time.Second
+)
+
+var errNoNewData = errors.New("no new data")
+
 // ReaderAPI describes API that reads log entries from journald. The API is a subset of sdjournal.Journal.
 type ReaderAPI interface {
 	Next() (uint64, error)
@@ -18,6 +34,17 @@ type ReaderAPI interface {
 	Wait(timeout time.Duration) int
 }
 
+// EndAPI describes API of an input that ends, e.g. a journal export, unlike a journal that journald keeps writing to.
+type EndAPI interface {
+	// AtEnd tells whether the end of the input is read, so there will be no new entry.
+	AtEnd() bool
+}
+
+// OpenFunc opens the journal and positions it so that the next call to Next advances to the entry after the given
+// cursor. An empty cursor means that no entry has been delivered yet, so the journal is positioned where reading
+// starts without a cursor.
+type OpenFunc func(cursor string) (ReaderAPI, error)
+
 // Reader reads journal entry into a channel and let consumer consume the channel.
 type Reader struct {
 	reader ReaderAPI
@@ -26,6 +53,45 @@ type Reader struct {
 
 	// Time to wait for new entry.
 	waitForDataTimeout time.Duration
+
+	// reopen replaces reader after a read error. If it is nil, the reader is retried as is.
+	reopen OpenFunc
+
+	// Number of consecutive read failures to give up after.
+	maxFailures int
+
+	// Exponential backoff between retries, from minBackoff up to maxBackoff.
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	// Cursor of the last entry put to the channel.
+	lastCursor string
+
+	// Whether Next advanced to an entry that GetEntry failed to read, so the entry is read again without advancing.
+	advanced bool
+
+	// Whether to report gaps between the last delivered entry and the first entry read after opening the journal.
+	detectGaps bool
+
+	// Whether the journal has matches, so seqnums of consecutive entries are not consecutive.
+	filtered bool
+
+	// The gap check of the first entry read after opening the journal.
+	pendingGapCheck *gapCheck
+
+	// Reopen the journal every refreshInterval while there is no new entry, if it is not 0. openedAt is when the
+	// journal was opened.
+	refreshInterval time.Duration
+	openedAt        time.Time
+
+	// tail returns the newest entry to measure the lag against, every lagInterval. It is nil if lag is not measured.
+	tail         TailFunc
+	lagInterval  time.Duration
+	lastLagCheck time.Time
+	// lagTicks ticks every lagInterval while Read runs, to measure the lag while an entry waits to be sent.
+	lagTicks      <-chan time.Time
+	lag           atomic.Pointer[Lag]
+	lastEntryRead *sdjournal.JournalEntry
 }
 
 func NewReader(reader ReaderAPI, opts ...Option) *Reader {
@@ -33,6 +99,9 @@ func NewReader(reader ReaderAPI, opts ...Option) *Reader {
 		reader:             reader,
 		waitForDataTimeout: time.Second,
 		entries:            make(chan *sdjournal.JournalEntry),
+		maxFailures:        defaultMaxFailures,
+		minBackoff:         defaultMinBackoff,
+		maxBackoff:         defaultMaxBackoff,
 	}
 	for _, opt := range opts {
 		opt(&r)
@@ -40,44 +109,231 @@ func NewReader(reader ReaderAPI, opts ...Option) *Reader {
 	return &r
 }
 
-// Entries returns a channel of JournalEntry read from journald. The returned channel is never closed.
+// Entries returns a channel of JournalEntry read from journald. The returned channel is closed only when the input
+// ends, see EndAPI.
 func (r *Reader) Entries() <-chan *sdjournal.JournalEntry {
 	return r.entries
 }
 
-// Read reads from log entries from journald and put them to the channel, until the ctx is canceled.
-func (r *Reader) Read(ctx context.Context) {
-	var errNoNewData = errors.New("no new data")
-	next := func() (*sdjournal.JournalEntry, error) {
-		advanced, err := r.reader.Next()
+// Lag returns the last measured lag of the reader behind the newest entry in the journal. It is safe to call
+// concurrently with Read.
+func (r *Reader) Lag() Lag {
+	if lag := r.lag.Load(); lag != nil {
+		return *lag
+	}
+	return Lag{}
+}
+
+// Read reads from log entries from journald and put them to the channel, until the ctx is canceled or reading fails
+// more than maxFailures times in a row. On a read error, it reopens the journal at the last delivered entry with
+// backoff. It returns the last read error if it gives up, or nil if the ctx is canceled or the input ends, see EndAPI.
+// Read closes the journal when it returns.
+func (r *Reader) Read(ctx context.Context) error {
+	defer r.close()
+
+	r.armGapCheck()
+	r.openedAt = time.Now()
+	if r.tail != nil {
+		ticker := time.NewTicker(r.lagInterval)
+		defer ticker.Stop()
+		r.lagTicks = ticker.C
+	}
+	failures := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+
+		r.measureLag()
+		entry, err := r.next()
+		switch {
+		case err == nil:
+			failures = 0
+			if r.pendingGapCheck != nil {
+				gap := r.pendingGapCheck.gapBefore(entry, r.filtered)
+				r.pendingGapCheck = nil
+				if gap != nil {
+					zap.S().Warn(gap.Fields["MESSAGE"])
+					if !r.send(ctx, gap) {
+						return nil
+					}
+				}
+			}
+			if !r.send(ctx, entry) {
+				return nil
+			}
+		case errors.Is(err, errNoNewData):
+			failures = 0
+			if end, ok := r.reader.(EndAPI); ok && end.AtEnd() {
+				zap.S().Infof("read the end of the input, last cursor %s", r.lastCursor)
+				close(r.entries)
+				return nil
+			}
+			r.reader.Wait(r.waitForDataTimeout)
+			if r.refreshInterval > 0 && r.reopen != nil && time.Since(r.openedAt) >= r.refreshInterval {
+				if err := r.reopenJournal(); err != nil {
+					zap.S().Errorf("cannot reopen journal, %v", err)
+				}
+			}
+		default:
+			failures++
+			if failures > r.maxFailures {
+				return fmt.Errorf("cannot read journal after %d attempts, %w", failures, err)
+			}
+			zap.S().Errorf("cannot read journal, attempt %d of %d, %v", failures, r.maxFailures, err)
+			if !r.sleep(ctx, r.backoff(failures)) {
+				return nil
+			}
+			if isTransientError(err) || r.reopen == nil {
+				continue
+			}
+			if err := r.reopenJournal(); err != nil {
+				zap.S().Errorf("cannot reopen journal, %v", err)
+			}
+		}
+	}
+}
+
+// next advances to the next entry and reads it. If reading the entry fails, the next call reads it again at the
+// current position, so the entry is not skipped.
+func (r *Reader) next() (*sdjournal.JournalEntry, error) {
+	if !r.advanced {
+		n, err := r.reader.Next()
 		if err != nil {
 			return nil, err
 		}
-		if advanced == 0 {
+		if n == 0 {
 			return nil, errNoNewData
 		}
-		return r.reader.GetEntry()
+		r.advanced = true
+	}
+	entry, err := r.reader.GetEntry()
+	if err != nil {
+		return nil, err
 	}
+	r.advanced = false
+	return entry, nil
+}
 
+// send puts the entry to the channel, and returns false if the ctx is canceled before that. It measures the lag while
+// it waits.
+func (r *Reader) send(ctx context.Context, entry *sdjournal.JournalEntry) bool {
 	for {
 		select {
+		case r.entries <- entry:
+			r.lastCursor = entry.Cursor
+			r.lastEntryRead = entry
+			return true
+		case <-r.lagTicks:
+			// The pipeline does not take the entry, e.g. CWL throttles, so the lag grows while no entry is read.
+			r.updateLag()
 		case <-ctx.Done():
-			return
-		default:
-			entry, err := next()
-			switch err {
-			case nil:
-				r.entries <- entry
-			case errNoNewData:
-				r.reader.Wait(r.waitForDataTimeout)
-			default:
-				// We don't know how to deal with error reading journal.
-				panic(err)
-			}
+			return false
 		}
 	}
 }
 
+// measureLag measures the lag behind the newest entry if lagInterval passed since the last measurement.
+func (r *Reader) measureLag() {
+	if r.tail == nil || time.Since(r.lastLagCheck) < r.lagInterval {
+		return
+	}
+	r.updateLag()
+}
+
+// updateLag measures the lag between the last entry sent and the newest entry.
+func (r *Reader) updateLag() {
+	r.lastLagCheck = time.Now()
+	if r.lastEntryRead == nil {
+		return
+	}
+	last, err := ParseCursor(r.lastEntryRead.Cursor)
+	if err != nil {
+		return
+	}
+	// Gap entries carry the cursor of the entry before the gap, so use the timestamp of the entry itself.
+	last.Realtime = r.lastEntryRead.RealtimeTimestamp
+	tail, err := r.tail()
+	if err != nil {
+		zap.S().Errorf("cannot measure lag, %v", err)
+		return
+	}
+	lag := lagBetween(last, tail, r.lastLagCheck)
+	r.lag.Store(&lag)
+}
+
+// armGapCheck prepares to check the first entry read from the newly opened journal for a gap. It must be called before
+// the first Next, when the journal is still at the last delivered entry if that entry exists.
+func (r *Reader) armGapCheck() {
+	r.pendingGapCheck = nil
+	if !r.detectGaps || r.lastCursor == "" {
+		return
+	}
+	check := gapCheck{cursor: r.lastCursor}
+	if tester, ok := r.reader.(CursorTesterAPI); ok {
+		check.cursorMissing = tester.TestCursor(r.lastCursor) != nil
+	}
+	r.pendingGapCheck = &check
+}
+
+// reopenJournal replaces the journal with a new one positioned after the last delivered entry. The old journal is kept
+// if the new one cannot be opened, so the next attempt can reopen again.
+func (r *Reader) reopenJournal() error {
+	reader, err := r.reopen(r.lastCursor)
+	if err != nil {
+		return err
+	}
+	r.close()
+	r.reader = reader
+	// The new journal is positioned before the entry that may have failed to be read.
+	r.advanced = false
+	r.armGapCheck()
+	r.openedAt = time.Now()
+	return nil
+}
+
+func (r *Reader) close() {
+	if c, ok := r.reader.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			zap.S().Errorf("cannot close journal, %v", err)
+		}
+	}
+}
+
+func (r *Reader) backoff(failures int) time.Duration {
+	d := r.minBackoff
+	for i := 1; i < failures && d < r.maxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, r.maxBackoff)
+}
+
+// sleep waits for d and returns false if the ctx is canceled before that.
+func (r *Reader) sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// isTransientError tells whether the error is likely to go away by retrying the same journal. Other errors, e.g. a
+// journal file that was rotated, vacuumed or corrupted, need the journal to be reopened. sdjournal does not wrap the
+// errno, so the error message is matched.
+func isTransientError(err error) bool {
+	for _, errno := range []syscall.Errno{syscall.EINTR, syscall.EAGAIN} {
+		if strings.HasSuffix(err.Error(), errno.Error()) {
+			return true
+		}
+	}
+	return false
+}
+
 type Option func(*Reader)
 
 func WithWaitForDataTimeout(d time.Duration) Option {
@@ -85,3 +341,59 @@ func WithWaitForDataTimeout(d time.Duration) Option {
 		r.waitForDataTimeout = d
 	}
 }
+
+// WithReopen sets the function to reopen the journal after a read error.
+func WithReopen(open OpenFunc) Option {
+	return func(r *Reader) {
+		r.reopen = open
+	}
+}
+
+// WithMaxFailures sets the number of consecutive read failures to give up after.
+func WithMaxFailures(n int) Option {
+	return func(r *Reader) {
+		r.maxFailures = n
+	}
+}
+
+// WithRetryBackoff sets the minimum and maximum backoff between retries.
+func WithRetryBackoff(minBackoff, maxBackoff time.Duration) Option {
+	return func(r *Reader) {
+		r.minBackoff = minBackoff
+		r.maxBackoff = maxBackoff
+	}
+}
+
+// WithLastCursor sets the cursor of the last entry delivered before the reader starts, e.g. the cursor in the state
+// file. The journal is reopened after it and gaps are checked against it.
+func WithLastCursor(cursor string) Option {
+	return func(r *Reader) {
+		r.lastCursor = cursor
+	}
+}
+
+// WithGapDetection reports a synthetic entry, see GapFromField, when entries are missing between the last delivered
+// entry and the first entry read after opening the journal. filtered tells whether the journal has matches or is a
+// subset of the files that share the seqnums, so that seqnums of consecutive entries are not consecutive.
+func WithGapDetection(filtered bool) Option {
+	return func(r *Reader) {
+		r.detectGaps = true
+		r.filtered = filtered
+	}
+}
+
+// WithRefresh reopens the journal with the reopen function every interval while there is no new entry. A journal opened
+// from a list of files does not see files created by rotation, so it must be reopened to follow the journal.
+func WithRefresh(interval time.Duration) Option {
+	return func(r *Reader) {
+		r.refreshInterval = interval
+	}
+}
+
+// WithLag measures the lag behind the newest entry returned by tail every interval, see Reader.Lag.
+func WithLag(tail TailFunc, interval time.Duration) Option {
+	return func(r *Reader) {
+		r.tail = tail
+		r.lagInterval = interval
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"math/rand"
 	"sync"
+	"syscall"
 	"testing"
 	"time"
 
@@ -50,7 +51,7 @@ func TestReadEntries(t *testing.T) {
 	}
 }
 
-func TestPanicOnError(t *testing.T) {
+func TestReadGivesUpOnError(t *testing.T) {
 	cases := []struct {
 		name                string
 		shouldNextError     bool
@@ -69,12 +70,136 @@ func TestPanicOnError(t *testing.T) {
 			j := newJournalStub(entries)
 			j.setShouldGetEntryError(tc.shouldGetEntryError)
 			j.setShouldNextError(tc.shouldNextError)
-			r := NewReader(j, WithWaitForDataTimeout(time.Millisecond))
-			assert.Panics(t, func() {
-				r.Read(ctx)
-			})
+			r := NewReader(j, WithWaitForDataTimeout(time.Millisecond), WithMaxFailures(3),
+				WithRetryBackoff(time.Millisecond, time.Millisecond))
+			assert.Error(t, r.Read(ctx))
+		})
+	}
+}
+
+func TestReadReopensOnError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var entries []*sdjournal.JournalEntry
+	for i := 0; i < 10; i++ {
+		entries = append(entries, &sdjournal.JournalEntry{
+			Cursor: fmt.Sprintf("cursor-%d", i),
+		})
+	}
+	j := newJournalStub(entries)
+	j.failGetEntryOnceAt = 5
+	var reopenedAt []string
+	reopen := func(cursor string) (ReaderAPI, error) {
+		reopenedAt = append(reopenedAt, cursor)
+		reopened := newJournalStub(entries)
+		reopened.seek(cursor)
+		return reopened, nil
+	}
+	r := NewReader(j, WithWaitForDataTimeout(time.Millisecond), WithReopen(reopen),
+		WithRetryBackoff(time.Millisecond, time.Millisecond))
+	readErr := make(chan error, 1)
+	go func() {
+		readErr <- r.Read(ctx)
+	}()
+
+	var entriesReceived []*sdjournal.JournalEntry
+	for i := 0; i < 10; i++ {
+		entriesReceived = append(entriesReceived, <-r.Entries())
+	}
+	cancel()
+
+	assert.NoError(t, <-readErr)
+	assert.Equal(t, entries, entriesReceived)
+	assert.Equal(t, []string{"cursor-4"}, reopenedAt)
+	assert.True(t, j.isClosed())
+}
+
+// TestReadRetriesGetEntry tests that an entry that fails to be read is read again at the same position, without
+// reopening the journal, so it is not skipped.
+func TestReadRetriesGetEntry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var entries []*sdjournal.JournalEntry
+	for i := 0; i < 10; i++ {
+		entries = append(entries, &sdjournal.JournalEntry{
+			Cursor: fmt.Sprintf("cursor-%d", i),
 		})
 	}
+	j := newJournalStub(entries)
+	j.failGetEntryOnceAt = 5
+	r := NewReader(j, WithWaitForDataTimeout(time.Millisecond), WithRetryBackoff(time.Millisecond, time.Millisecond))
+	go r.Read(ctx)
+
+	var entriesReceived []*sdjournal.JournalEntry
+	for i := 0; i < 10; i++ {
+		entriesReceived = append(entriesReceived, <-r.Entries())
+	}
+	assert.Equal(t, entries, entriesReceived)
+}
+
+func TestReadRefreshesWhenIdle(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var entries []*sdjournal.JournalEntry
+	for i := 0; i < 5; i++ {
+		entries = append(entries, &sdjournal.JournalEntry{
+			Cursor: fmt.Sprintf("cursor-%d", i),
+		})
+	}
+	// The first journal misses the entries in a file created after it was opened.
+	j := newJournalStub(entries[:3])
+	reopen := func(cursor string) (ReaderAPI, error) {
+		reopened := newJournalStub(entries)
+		reopened.seek(cursor)
+		return reopened, nil
+	}
+	r := NewReader(j, WithWaitForDataTimeout(time.Millisecond), WithReopen(reopen), WithRefresh(time.Millisecond))
+	readErr := make(chan error, 1)
+	go func() {
+		readErr <- r.Read(ctx)
+	}()
+
+	var entriesReceived []*sdjournal.JournalEntry
+	for i := 0; i < 5; i++ {
+		entriesReceived = append(entriesReceived, <-r.Entries())
+	}
+	cancel()
+
+	assert.NoError(t, <-readErr)
+	assert.Equal(t, entries, entriesReceived)
+	assert.True(t, j.isClosed())
+}
+
+func TestReadKeepsJournalIfReopenFails(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	j := newJournalStub(make([]*sdjournal.JournalEntry, 10))
+	j.setShouldNextError(true)
+	reopen := func(string) (ReaderAPI, error) {
+		return nil, errors.New("no such file or directory")
+	}
+	r := NewReader(j, WithWaitForDataTimeout(time.Millisecond), WithReopen(reopen), WithMaxFailures(2),
+		WithRetryBackoff(time.Millisecond, time.Millisecond))
+	assert.Error(t, r.Read(ctx))
+	assert.True(t, j.isClosed())
+}
+
+func TestBackoff(t *testing.T) {
+	r := NewReader(nil, WithRetryBackoff(time.Second, 5*time.Second))
+	assert.Equal(t, time.Second, r.backoff(1))
+	assert.Equal(t, 2*time.Second, r.backoff(2))
+	assert.Equal(t, 4*time.Second, r.backoff(3))
+	assert.Equal(t, 5*time.Second, r.backoff(4))
+	assert.Equal(t, 5*time.Second, r.backoff(100))
+}
+
+func TestIsTransientError(t *testing.T) {
+	assert.True(t, isTransientError(fmt.Errorf("failed to iterate journal: %s", syscall.EAGAIN.Error())))
+	assert.False(t, isTransientError(fmt.Errorf("failed to iterate journal: %s", syscall.EBADMSG.Error())))
 }
 
 // journalStub pretends to be journal reader and returns the given entries one by one.
@@ -86,14 +211,20 @@ type journalStub struct {
 
 	shouldNextError     bool
 	shouldGetEntryError bool
+
+	// GetEntry fails once when reading the entry at this index.
+	failGetEntryOnceAt int
+
+	closed bool
 }
 
 func newJournalStub(
 	entries []*sdjournal.JournalEntry,
 ) *journalStub {
 	return &journalStub{
-		entries: entries,
-		index:   -1,
+		entries:            entries,
+		index:              -1,
+		failGetEntryOnceAt: -1,
 	}
 }
 
@@ -116,6 +247,10 @@ func (j *journalStub) GetEntry() (*sdjournal.JournalEntry, error) {
 	if j.shouldGetEntryError {
 		return nil, errors.New("cannot read entry")
 	}
+	if j.index == j.failGetEntryOnceAt {
+		j.failGetEntryOnceAt = -1
+		return nil, errors.New("cannot read entry")
+	}
 	return j.entries[j.index], nil
 }
 
@@ -124,6 +259,31 @@ func (j *journalStub) Wait(d time.Duration) int {
 	return 0
 }
 
+func (j *journalStub) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.closed = true
+	return nil
+}
+
+// seek positions the stub so that Next advances to the entry after the cursor.
+func (j *journalStub) seek(cursor string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for i, e := range j.entries {
+		if e.Cursor == cursor {
+			j.index = i
+			return
+		}
+	}
+}
+
+func (j *journalStub) isClosed() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.closed
+}
+
 func (j *journalStub) setShouldNextError(b bool) {
 	j.mu.Lock()
 	defer j.mu.Unlock()
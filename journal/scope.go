@@ -0,0 +1,81 @@
+package journal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+var machineIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// SystemJournalFiles returns the files of the system journal of the machine in the given journal directories, the
+// active "system.journal" and its archives, like `journalctl --system`.
+func SystemJournalFiles(dirs []string, machineID string) ([]string, error) {
+	return journalFiles(dirs, machineID, "system")
+}
+
+// UserJournalFiles returns the files of the journal of the user in the given journal directories, the active
+// "user-<uid>.journal" and its archives, like `journalctl --user` run by the user.
+func UserJournalFiles(dirs []string, machineID string, uid string) ([]string, error) {
+	return journalFiles(dirs, machineID, "user-"+uid)
+}
+
+// journalFiles returns the active journal file with the name and its archives. Archives are named
+// "<name>@<id>.journal", or end with "~" if they were not closed cleanly.
+func journalFiles(dirs []string, machineID string, name string) ([]string, error) {
+	var files []string
+	for _, dir := range dirs {
+		base := filepath.Join(dir, machineID, name)
+		for _, pattern := range []string{base + ".journal", base + "@*.journal", base + "@*.journal~"} {
+			matches, err := filepath.Glob(pattern)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, matches...)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("cannot find %s journal files in %v", name, dirs)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Containers returns the sorted machine ids of systemd-nspawn containers whose journals are linked to the given journal
+// directories of the host, i.e. the directories named by a machine id other than the machine id of the host.
+func Containers(dirs []string, machineID string) ([]string, error) {
+	seen := make(map[string]bool)
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot list journal directory %s, %w", dir, err)
+		}
+		for _, e := range entries {
+			if e.IsDir() && e.Name() != machineID && machineIDPattern.MatchString(e.Name()) {
+				seen[e.Name()] = true
+			}
+		}
+	}
+	containers := make([]string, 0, len(seen))
+	for id := range seen {
+		containers = append(containers, id)
+	}
+	sort.Strings(containers)
+	return containers, nil
+}
+
+// MachineDir returns the first of the given journal directories that has journals of the machine.
+func MachineDir(dirs []string, machineID string) (string, error) {
+	for _, dir := range dirs {
+		path := filepath.Join(dir, machineID)
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("cannot find journal directory of machine %s in %v", machineID, dirs)
+}
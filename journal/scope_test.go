@@ -0,0 +1,70 @@
+package journal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var dummyContainerID = "0123456789abcdef0123456789abcdef"
+
+func TestJournalFiles(t *testing.T) {
+	persistent, volatile := t.TempDir(), t.TempDir()
+	for _, dir := range []string{persistent, volatile} {
+		assert.NoError(t, os.Mkdir(filepath.Join(dir, dummyMachineID), 0700))
+	}
+	for _, file := range []string{
+		filepath.Join(persistent, dummyMachineID, "system.journal"),
+		filepath.Join(persistent, dummyMachineID, "system@0001-0002.journal"),
+		filepath.Join(persistent, dummyMachineID, "system@0003-0004.journal~"),
+		filepath.Join(persistent, dummyMachineID, "user-1000.journal"),
+		filepath.Join(persistent, dummyMachineID, "user-10000.journal"),
+		filepath.Join(volatile, dummyMachineID, "system.journal"),
+	} {
+		assert.NoError(t, os.WriteFile(file, nil, 0600))
+	}
+	dirs := []string{persistent, volatile}
+
+	files, err := SystemJournalFiles(dirs, dummyMachineID)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		filepath.Join(persistent, dummyMachineID, "system.journal"),
+		filepath.Join(persistent, dummyMachineID, "system@0001-0002.journal"),
+		filepath.Join(persistent, dummyMachineID, "system@0003-0004.journal~"),
+		filepath.Join(volatile, dummyMachineID, "system.journal"),
+	}, files)
+
+	files, err = UserJournalFiles(dirs, dummyMachineID, "1000")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(persistent, dummyMachineID, "user-1000.journal")}, files)
+
+	_, err = UserJournalFiles(dirs, dummyMachineID, "1001")
+	assert.Error(t, err)
+}
+
+func TestContainers(t *testing.T) {
+	persistent, volatile := t.TempDir(), t.TempDir()
+	for _, dir := range []string{
+		filepath.Join(persistent, dummyMachineID),
+		filepath.Join(persistent, dummyMachineID+".foo"),
+		filepath.Join(persistent, dummyContainerID),
+		filepath.Join(persistent, "remote"),
+		filepath.Join(volatile, dummyMachineID),
+	} {
+		assert.NoError(t, os.Mkdir(dir, 0700))
+	}
+	dirs := []string{persistent, volatile, filepath.Join(persistent, "non-exist")}
+
+	containers, err := Containers(dirs, dummyMachineID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{dummyContainerID}, containers)
+
+	dir, err := MachineDir(dirs, dummyContainerID)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(persistent, dummyContainerID), dir)
+
+	_, err = MachineDir(dirs, "a1111111111111111111111111111111")
+	assert.Error(t, err)
+}
@@ -7,13 +7,13 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
-	"github.com/coreos/go-systemd/v22/sdjournal"
 	"go.uber.org/zap"
 
 	"snappydevtools.com/journald-to-cwl/batch"
@@ -22,6 +22,9 @@ import (
 	"snappydevtools.com/journald-to-cwl/journal"
 )
 
+// filesRefreshInterval is how often a journal opened from a list of files is reopened while idle, to follow rotation.
+const filesRefreshInterval = 30 * time.Second
+
 var (
 	region     string
 	instanceID string
@@ -40,6 +43,18 @@ func main() {
 
 	flag.Parse()
 
+	if err := run(); err != nil {
+		// Exit with failure and let systemd restart the service.
+		zap.S().Errorf("stop reading journal, %v", err)
+		_ = logger.Sync()
+		os.Exit(1)
+	}
+}
+
+// run ships the journals until a signal to exit is received, reading a journal fails, or all sources end, e.g. an
+// export is shipped to its end. It returns the read error. It stops the pipelines before it returns, so the cursors and
+// the in-flight markers are saved and the state file is closed.
+func run() error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -51,6 +66,9 @@ func main() {
 	if err != nil {
 		zap.S().Panic(err)
 	}
+	if c.LogStream == "" {
+		c.LogStream = sourceMachineID(c)
+	}
 	zap.S().Infof("Use config, %+v", c)
 
 	cursor, err := NewFilebasedCursor(c.StateFile)
@@ -59,32 +77,40 @@ func main() {
 	}
 	defer cursor.Close()
 
-	journalReader, err := initializeJournalReader(cursor)
+	sources, err := journalSources(c)
 	if err != nil {
 		zap.S().Panic(err)
 	}
-	defer journalReader.Close()
-
-	// There are three go routines. Read -> Batch -> Write
-	// Read journald entries.
-	reader := journal.NewReader(journalReader, journal.WithWaitForDataTimeout(time.Second))
-	go reader.Read(ctx)
-
-	// Batch journald entries to Cloudwatch log events.
-	batcher := batch.NewBatcher(reader.Entries(), batch.NewEntryToEventConverter(instanceID, time.Now))
-	go batcher.Batch(ctx)
-
-	// Write batches to Cloudwatch log.
-	writer := cwl.NewWriter(batcher.Batches(), cwlClient, c.LogGroup, c.LogStream, func(v string) error {
-		return cursor.Set(v)
-	})
-	go writer.Write(ctx)
+	readErr := make(chan error, len(sources))
+	shipped := make(chan string, len(sources))
+	var writers sync.WaitGroup
+	defer func() {
+		// Stop the pipelines and wait for the writers, which save the cursor of the batch they are writing.
+		cancel()
+		writers.Wait()
+	}()
+	for _, src := range sources {
+		if err := startPipeline(ctx, c, src, cursor, readErr, shipped, &writers); err != nil {
+			zap.S().Panic(err)
+		}
+	}
 
 	// Grace shutdown
 	ch := make(chan os.Signal, 1)
 	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
-	s := <-ch
-	zap.S().Infof("exit signal %v", s)
+	for ended := 0; ended < len(sources); {
+		select {
+		case s := <-ch:
+			zap.S().Infof("exit signal %v", s)
+			return nil
+		case err := <-readErr:
+			return err
+		case name := <-shipped:
+			zap.S().Infof("shipped journal source %s to its end", name)
+			ended++
+		}
+	}
+	return nil
 }
 
 func initializeAWS() error {
@@ -112,22 +138,204 @@ func initializeAWS() error {
 	return nil
 }
 
-func initializeJournalReader(cursor Cursor) (*sdjournal.Journal, error) {
-	j, err := sdjournal.NewJournal()
+// startPipeline reads, batches and writes entries of the journal source to CWL, until the ctx is canceled. If reading
+// fails, the error is sent to readErr. If the source ends, its name is sent to shipped once the last batch is written.
+// The writer is added to writers, which is done when the writer stops.
+func startPipeline(
+	ctx context.Context,
+	c *config.Config,
+	src journalSource,
+	state *FilebasedCursor,
+	readErr chan<- error,
+	shipped chan<- string,
+	writers *sync.WaitGroup,
+) error {
+	cursor := state.ForSource(src.name())
+	inFlight := state.ForSource(src.name() + inFlightSuffix)
+	recoverInFlight(ctx, cwlClient, c, cursor, inFlight)
+
+	v, err := cursor.Get()
 	if err != nil {
-		return nil, fmt.Errorf("cannot create journal reader, %v", err)
+		zap.S().Errorf("cannot read journal cursor, %v. start with the start position.", err)
+		v = ""
+	}
+	// The reader owns the journal, reopens it on errors and closes it when it stops reading.
+	journalReader, err := openSource(c, src, v)
+	if err != nil {
+		return err
+	}
+	readerOpts := []journal.Option{
+		journal.WithWaitForDataTimeout(time.Second),
+		journal.WithMaxFailures(c.MaxReadFailures),
+		journal.WithLastCursor(v),
+		// The system and user journals are subsets of the journal files, whose seqnums are shared by all of them.
+		journal.WithGapDetection(len(c.MatchGroups) > 0 || src.files != nil),
+	}
+	if c.ExportFile == "" && c.LagInterval > 0 {
+		readerOpts = append(readerOpts, journal.WithLag(journalTail(c, src), c.LagInterval))
+	}
+	if canReopen(c) {
+		readerOpts = append(readerOpts, journal.WithReopen(func(v string) (journal.ReaderAPI, error) {
+			return openSource(c, src, v)
+		}))
+	}
+	if src.files != nil {
+		readerOpts = append(readerOpts, journal.WithRefresh(filesRefreshInterval))
 	}
 
-	v, err := cursor.Get()
+	// There are four go routines. Read -> Assemble -> Batch -> Write
+	// Read journald entries.
+	reader := journal.NewReader(journalReader, readerOpts...)
+	go func() {
+		if err := reader.Read(ctx); err != nil {
+			readErr <- err
+		}
+	}()
+	if c.ExportFile == "" && c.LagInterval > 0 {
+		go logLag(ctx, src, reader, c.LagInterval)
+	}
+
+	// Reassemble lines of containers and merge lines of multi-line messages.
+	assemblerOpts := []journal.AssemblerOption{
+		journal.WithMultilineTimeout(c.MultilineTimeout),
+		journal.WithMultilineMaxLines(c.MultilineMaxLines),
+		journal.WithMultilineUnits(c.MultilineUnits...),
+	}
+	if c.MultilineStartPattern != nil {
+		assemblerOpts = append(assemblerOpts, journal.WithStartPattern(c.MultilineStartPattern))
+	}
+	if c.MultilineContinuePattern != nil {
+		assemblerOpts = append(assemblerOpts, journal.WithContinuationPattern(c.MultilineContinuePattern))
+	}
+	if c.ExportFile == "" {
+		// Exports are not cut by the data threshold.
+		assemblerOpts = append(assemblerOpts, journal.WithDataThreshold(c.DataThreshold))
+	}
+	assembler := journal.NewAssembler(reader.Entries(), assemblerOpts...)
+	go assembler.Assemble(ctx)
+
+	// Batch journald entries to Cloudwatch log events.
+	converterOpts := []batch.ConverterOption{
+		batch.WithNamespace(src.namespace),
+		batch.WithOrigin(src.origin),
+		batch.WithBinaryEncoding(c.BinaryEncoding),
+		batch.WithFormat(c.Format),
+		batch.WithIncludeFields(c.Fields...),
+		batch.WithExcludeFields(c.ExcludeFields...),
+		batch.WithFieldNames(c.FieldNames),
+		batch.WithTimestamp(c.Timestamp),
+		batch.WithMaxMessageSize(c.MaxMessageSize),
+	}
+	if c.SplitMessages {
+		converterOpts = append(converterOpts, batch.WithSplitMessages())
+	}
+	if len(c.RedactionRules) > 0 {
+		converterOpts = append(converterOpts, batch.WithRedaction(c.RedactFields, redactionRules(c)...))
+	}
+	if len(c.Parsers) > 0 {
+		converterOpts = append(converterOpts, batch.WithParsers(c.ParseMessageKey, c.Parsers...))
+	}
+	if len(c.ParseMessage) > 0 {
+		converterOpts = append(converterOpts, batch.WithMessageParsing(c.ParseMessageKey, c.ParseMessage...))
+	}
+	if c.AuthEvents {
+		converterOpts = append(converterOpts, batch.WithAuthEvents())
+	}
+	if len(c.Detectors) > 0 {
+		converterOpts = append(converterOpts, batch.WithDetectors(c.DetectorAction, c.DetectorHashKey, c.Detectors...))
+	}
+	converter := batch.NewEntryToEventConverter(instanceID, time.Now, converterOpts...)
+	batcher := batch.NewBatcher(assembler.Entries(), converter, batch.WithLastCursor(v))
+	go batcher.Batch(ctx)
+
+	// Write batches to Cloudwatch log.
+	writer := cwl.NewWriter(batcher.Batches(), cwlClient, c.LogGroup, c.LogStream, cursor.Set,
+		cwl.WithSaveInFlight(inFlight.Set))
+	writers.Add(1)
+	go func() {
+		defer writers.Done()
+		writer.Write(ctx)
+		// The writer returns before the ctx is canceled only when the batches end, see journal.EndAPI.
+		if ctx.Err() == nil {
+			shipped <- src.name()
+		}
+	}()
+	return nil
+}
+
+// redactionRules converts the redaction rules of the config for the converter.
+func redactionRules(c *config.Config) []batch.RedactionRule {
+	rules := make([]batch.RedactionRule, 0, len(c.RedactionRules))
+	for _, r := range c.RedactionRules {
+		rules = append(rules, batch.RedactionRule{
+			Pattern:     r.Pattern,
+			Replacement: r.Replacement,
+			Unit:        r.Unit,
+			Identifier:  r.Identifier,
+		})
+	}
+	return rules
+}
+
+// logLag logs the lag of the reader every interval. It logs once per interval at most, since journald-to-cwl logs to
+// the journal it reads.
+func logLag(ctx context.Context, src journalSource, reader *journal.Reader, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		lag := reader.Lag()
+		if lag.MeasuredAt.IsZero() {
+			continue
+		}
+		fields := []any{"source", src.name(), "seconds", lag.Duration.Seconds(), "measuredAt", lag.MeasuredAt}
+		if lag.EntriesKnown {
+			fields = append(fields, "entries", lag.Entries)
+		}
+		zap.S().Infow("reader lag", fields...)
+	}
+}
+
+// recoverInFlight checks whether the batch that was being written when journald-to-cwl stopped is in CWL. If it is,
+// the cursor is moved to the end of the batch so the batch is not written again. Otherwise, the batch is read and
+// written again from the saved cursor.
+func recoverInFlight(
+	ctx context.Context,
+	client cwl.CloudwatchLogsAPI,
+	c *config.Config,
+	cursor Cursor,
+	inFlight Cursor,
+) {
+	marker, err := inFlight.Get()
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err := inFlight.Set(""); err != nil {
+			zap.S().Errorf("cannot clear in-flight marker, %v", err)
+		}
+	}()
+	f, err := cwl.ParseInFlight(marker)
+	if err != nil {
+		zap.S().Errorf("cannot parse in-flight marker, %v", err)
+		return
+	}
+	ok, err := cwl.Acknowledged(ctx, client, c.LogGroup, c.LogStream, f)
 	if err != nil {
-		zap.S().Errorf("cannot read journal cursor, %v. start with the oldest entry.", err)
-		_ = j.SeekHead()
-		return j, nil
+		zap.S().Errorf("cannot verify the in-flight batch, write it again. %v", err)
+		return
+	}
+	// A batch that only has log events of the first entry, which spans batches, has no cursor. Saving the empty cursor
+	// would delete the saved one.
+	if !ok || f.Cursor == "" {
+		return
 	}
-	if err := j.SeekCursor(v); err != nil {
-		zap.S().Errorf("cannot seek to cursor, seek to head instead. %v", err)
-		_ = j.SeekHead()
+	zap.S().Infof("the in-flight batch is already written, skip to cursor %s", f.Cursor)
+	if err := cursor.Set(f.Cursor); err != nil {
+		zap.S().Errorf("cannot save cursor, %v", err)
 	}
-	_, _ = j.Next()
-	return j, nil
 }
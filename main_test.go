@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/stretchr/testify/assert"
+
+	"snappydevtools.com/journald-to-cwl/batch"
+	"snappydevtools.com/journald-to-cwl/config"
+	"snappydevtools.com/journald-to-cwl/cwl"
+)
+
+// cwlStub returns the events from GetLogEvents.
+type cwlStub struct {
+	events []types.OutputLogEvent
+}
+
+func (s *cwlStub) PutLogEvents(context.Context, *cloudwatchlogs.PutLogEventsInput,
+	...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.PutLogEventsOutput, error) {
+	return &cloudwatchlogs.PutLogEventsOutput{}, nil
+}
+
+func (s *cwlStub) CreateLogStream(context.Context, *cloudwatchlogs.CreateLogStreamInput,
+	...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.CreateLogStreamOutput, error) {
+	return &cloudwatchlogs.CreateLogStreamOutput{}, nil
+}
+
+func (s *cwlStub) GetLogEvents(context.Context, *cloudwatchlogs.GetLogEventsInput,
+	...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.GetLogEventsOutput, error) {
+	return &cloudwatchlogs.GetLogEventsOutput{Events: s.events}, nil
+}
+
+func TestRecoverInFlight(t *testing.T) {
+	for _, batchCursor := range []string{"cursor-1", ""} {
+		state, err := NewFilebasedCursor(filepath.Join(t.TempDir(), "state"))
+		assert.NoError(t, err)
+		cursor := state.ForSource("system")
+		inFlight := state.ForSource("system" + inFlightSuffix)
+		assert.NoError(t, cursor.Set("cursor-0"))
+
+		event := types.InputLogEvent{Timestamp: aws.Int64(1722650790111), Message: aws.String("hello")}
+		b := &batch.Batch{Events: []types.InputLogEvent{event}, Cursor: batchCursor}
+		assert.NoError(t, inFlight.Set(cwl.NewInFlight(b).String()))
+		s := &cwlStub{events: []types.OutputLogEvent{{Timestamp: event.Timestamp, Message: event.Message}}}
+
+		recoverInFlight(context.Background(), s, &config.Config{}, cursor, inFlight)
+
+		v, err := cursor.Get()
+		assert.NoError(t, err)
+		if batchCursor == "" {
+			// The batch of the first entry, which spans batches, keeps the saved cursor.
+			assert.Equal(t, "cursor-0", v)
+		} else {
+			assert.Equal(t, batchCursor, v)
+		}
+		_, err = inFlight.Get()
+		assert.ErrorIs(t, err, errNoCursor)
+		assert.NoError(t, state.Close())
+	}
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/sdjournal"
+	"go.uber.org/zap"
+
+	"snappydevtools.com/journald-to-cwl/config"
+	"snappydevtools.com/journald-to-cwl/journal"
+)
+
+const (
+	machineIDFile = "/etc/machine-id"
+
+	// inFlightSuffix makes the state file key of the in-flight marker of a source. Source names have no "@".
+	inFlightSuffix = "@in-flight"
+)
+
+// journalSource is a journal that is read by its own pipeline and has its own cursor.
+type journalSource struct {
+	// namespace is the journald namespace, empty for the default journal.
+	namespace string
+
+	// origin is the configured journal, see config.Config.Journals, empty for the default journal.
+	origin string
+
+	// dir is the directory of the journals of the namespace or container.
+	dir string
+
+	// files lists the journal files of the source, if it is not a directory. It is called every time the journal is
+	// opened, so files created by rotation are included.
+	files func() ([]string, error)
+}
+
+// name identifies the source in the state file. The local journal shares the name of the default journal, so it keeps
+// the cursor of the default journal. Other journals are prefixed with "journal/", which namespaces cannot have.
+func (s journalSource) name() string {
+	if s.origin == "" || s.origin == config.JournalLocal {
+		return s.namespace
+	}
+	return "journal/" + s.origin
+}
+
+// journalSources returns the configured journals, the default journal by default, and the journals of the configured
+// namespaces.
+func journalSources(c *config.Config) ([]journalSource, error) {
+	if len(c.Namespaces) == 0 && len(c.Journals) == 0 {
+		return []journalSource{{}}, nil
+	}
+
+	b, err := os.ReadFile(machineIDFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read machine id, %w", err)
+	}
+	machineID := strings.TrimSpace(string(b))
+
+	sources := []journalSource{{}}
+	if len(c.Journals) > 0 {
+		if sources, err = configuredJournals(c.Journals, machineID); err != nil {
+			return nil, err
+		}
+	}
+
+	namespaces := c.Namespaces
+	if slices.Contains(namespaces, config.AllNamespaces) {
+		if namespaces, err = journal.Namespaces(journal.DefaultJournalDirs, machineID); err != nil {
+			return nil, err
+		}
+	}
+	for _, ns := range namespaces {
+		dir, err := journal.NamespaceDir(journal.DefaultJournalDirs, machineID, ns)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, journalSource{namespace: ns, dir: dir})
+	}
+	return sources, nil
+}
+
+// configuredJournals returns the sources of the journals, see config.Config.Journals.
+func configuredJournals(journals []string, machineID string) ([]journalSource, error) {
+	var sources []journalSource
+	for _, j := range journals {
+		switch {
+		case j == config.JournalLocal:
+			sources = append(sources, journalSource{origin: j})
+		case j == config.JournalSystem:
+			sources = append(sources, journalSource{origin: j, files: func() ([]string, error) {
+				return journal.SystemJournalFiles(journal.DefaultJournalDirs, machineID)
+			}})
+		case strings.HasPrefix(j, config.JournalUserPrefix):
+			uid, err := lookupUID(strings.TrimPrefix(j, config.JournalUserPrefix))
+			if err != nil {
+				return nil, err
+			}
+			files := func() ([]string, error) {
+				return journal.UserJournalFiles(journal.DefaultJournalDirs, machineID, uid)
+			}
+			sources = append(sources, journalSource{origin: config.JournalUserPrefix + uid, files: files})
+		case strings.HasPrefix(j, config.JournalContainerPrefix):
+			ids := []string{strings.TrimPrefix(j, config.JournalContainerPrefix)}
+			if ids[0] == config.AllContainers {
+				var err error
+				if ids, err = journal.Containers(journal.DefaultJournalDirs, machineID); err != nil {
+					return nil, err
+				}
+			}
+			for _, id := range ids {
+				dir, err := journal.MachineDir(journal.DefaultJournalDirs, id)
+				if err != nil {
+					return nil, err
+				}
+				sources = append(sources, journalSource{origin: config.JournalContainerPrefix + id, dir: dir})
+			}
+		}
+	}
+	return sources, nil
+}
+
+// lookupUID returns the uid of the user name or uid.
+func lookupUID(nameOrUID string) (string, error) {
+	if _, err := strconv.ParseUint(nameOrUID, 10, 32); err == nil {
+		return nameOrUID, nil
+	}
+	u, err := user.Lookup(nameOrUID)
+	if err != nil {
+		return "", fmt.Errorf("cannot find user %s, %w", nameOrUID, err)
+	}
+	return u.Uid, nil
+}
+
+// openSource opens the journal, or the export file if configured, so the next entry read is the one after the cursor.
+func openSource(c *config.Config, src journalSource, cursor string) (journal.ReaderAPI, error) {
+	if c.ExportFile != "" {
+		e, err := journal.OpenExportFile(c.ExportFile, cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cursor == "" && c.Start.Kind == config.StartSince {
+			_ = e.SeekRealtimeUsec(uint64(c.Start.Since(time.Now()).UnixMicro())) //nolint:gosec
+		}
+		return e, nil
+	}
+	j, err := openJournal(c, src, cursor)
+	if err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// canReopen tells whether the source can be opened again after a read error. The standard input cannot.
+func canReopen(c *config.Config) bool {
+	return c.ExportFile != journal.Stdin
+}
+
+// openJournal opens the journal and seeks to the entry at the cursor, so the next entry read is the one after it. It
+// seeks to the configured start position if the cursor is empty or not found.
+func openJournal(c *config.Config, src journalSource, cursor string) (*sdjournal.Journal, error) {
+	j, err := newJournal(c, src)
+	if err != nil {
+		return nil, err
+	}
+	if err := journal.AddMatches(j, c.MatchGroups); err != nil {
+		_ = j.Close()
+		return nil, err
+	}
+	if err := j.SetDataThreshold(uint64(c.DataThreshold)); err != nil { //nolint:gosec
+		_ = j.Close()
+		return nil, err
+	}
+
+	if cursor != "" {
+		if err := j.SeekCursor(cursor); err == nil {
+			_, _ = j.Next()
+			if err := j.TestCursor(cursor); err != nil {
+				// The entry at cursor no longer exists, e.g. vacuumed, and the journal is at the closest entry
+				// after it, which is not read yet. Step back so the next entry read is that one.
+				zap.S().Warnf("cannot find the entry at cursor, start with the entry after it. %v", err)
+				if moved, _ := j.Previous(); moved == 0 {
+					_ = j.SeekHead()
+				}
+			}
+			return j, nil
+		}
+		zap.S().Errorf("cannot seek to cursor, seek to start position %s instead. %v", c.StartPosition, err)
+	}
+	if err := seekStart(j, c.Start, c.MatchGroups); err != nil {
+		zap.S().Errorf("cannot seek to start position %s, seek to head instead. %v", c.StartPosition, err)
+		_ = j.SeekHead()
+	}
+	return j, nil
+}
+
+// journalTail returns a journal.TailFunc that reads the position of the newest entry of the source that matches the
+// configured matches. It opens its own journal, so it does not move the journal being read.
+func journalTail(c *config.Config, src journalSource) journal.TailFunc {
+	return func() (journal.Position, error) {
+		j, err := newJournal(c, src)
+		if err != nil {
+			return journal.Position{}, err
+		}
+		defer j.Close()
+		if err := journal.AddMatches(j, c.MatchGroups); err != nil {
+			return journal.Position{}, err
+		}
+		if err := j.SeekTail(); err != nil {
+			return journal.Position{}, err
+		}
+		if _, err := j.Previous(); err != nil {
+			return journal.Position{}, err
+		}
+		cursor, err := j.GetCursor()
+		if err != nil {
+			return journal.Position{}, err
+		}
+		return journal.ParseCursor(cursor)
+	}
+}
+
+// seekStart seeks to the start position, so the next entry read is the first entry to ship. matchGroups are the
+// matches of the journal, see journal.AddMatches.
+func seekStart(j *sdjournal.Journal, p config.StartPosition, matchGroups [][]string) error {
+	switch p.Kind {
+	case config.StartTail:
+		if err := j.SeekTail(); err != nil {
+			return err
+		}
+		// Move to the last entry, so the next entry read is the first one written after it.
+		_, err := j.Previous()
+		return err
+	case config.StartSince:
+		return j.SeekRealtimeUsec(uint64(p.Since(time.Now()).UnixMicro())) //nolint:gosec
+	case config.StartCurrentBoot:
+		return seekCurrentBoot(j, matchGroups)
+	default:
+		return j.SeekHead()
+	}
+}
+
+// seekCurrentBoot seeks to the first entry of the current boot, by _BOOT_ID, so it does not depend on the clock. The
+// matches of the journal are replaced by a match of the boot to find the entry, and added back after. If the boot has
+// no entry yet, it seeks to the tail.
+func seekCurrentBoot(j *sdjournal.Journal, matchGroups [][]string) error {
+	bootID, err := j.GetBootID()
+	if err != nil {
+		return err
+	}
+	j.FlushMatches()
+	cursor, findErr := func() (string, error) {
+		if err := j.AddMatch(sdjournal.SD_JOURNAL_FIELD_BOOT_ID + "=" + bootID); err != nil {
+			return "", err
+		}
+		if err := j.SeekHead(); err != nil {
+			return "", err
+		}
+		if n, err := j.Next(); err != nil || n == 0 {
+			return "", err
+		}
+		return j.GetCursor()
+	}()
+	j.FlushMatches()
+	if err := journal.AddMatches(j, matchGroups); err != nil {
+		return err
+	}
+	if findErr != nil {
+		return findErr
+	}
+	if cursor == "" {
+		return seekStart(j, config.StartPosition{Kind: config.StartTail}, matchGroups)
+	}
+	// The next entry read is the entry at the cursor, or the first entry after it that matches.
+	return j.SeekCursor(cursor)
+}
+
+// newJournal opens the journal of the source, the configured journal directory or files, or the local journal by
+// default.
+func newJournal(c *config.Config, src journalSource) (*sdjournal.Journal, error) {
+	var j *sdjournal.Journal
+	var err error
+	switch {
+	case src.files != nil:
+		var files []string
+		if files, err = src.files(); err == nil {
+			j, err = sdjournal.NewJournalFromFiles(files...)
+		}
+	case src.dir != "":
+		j, err = sdjournal.NewJournalFromDir(src.dir)
+	case c.JournalDirectory != "":
+		j, err = sdjournal.NewJournalFromDir(c.JournalDirectory)
+	case len(c.JournalFiles) > 0:
+		j, err = sdjournal.NewJournalFromFiles(c.JournalFiles...)
+	default:
+		j, err = sdjournal.NewJournal()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot create journal reader, %v", err)
+	}
+	return j, nil
+}
+
+// sourceMachineID returns the machine id of the configured journal directory or files, or the instance id if it
+// cannot be read.
+func sourceMachineID(c *config.Config) string {
+	if c.ExportFile != "" {
+		return exportMachineID(c.ExportFile)
+	}
+	j, err := newJournal(c, journalSource{})
+	if err != nil {
+		zap.S().Errorf("cannot read source machine id, use instance id instead. %v", err)
+		return instanceID
+	}
+	defer j.Close()
+	id, err := journal.MachineID(j)
+	if err != nil {
+		zap.S().Errorf("cannot read source machine id, use instance id instead. %v", err)
+		return instanceID
+	}
+	return id
+}
+
+// exportMachineID returns the machine id of the first entry in the export file, or the instance id if it cannot be
+// read. The standard input cannot be read twice, so it always uses the instance id.
+func exportMachineID(fileName string) string {
+	if fileName == journal.Stdin {
+		return instanceID
+	}
+	e, err := journal.OpenExportFile(fileName, "")
+	if err != nil {
+		zap.S().Errorf("cannot read source machine id, use instance id instead. %v", err)
+		return instanceID
+	}
+	defer e.Close()
+	id, err := func() (string, error) {
+		if _, err := e.Next(); err != nil {
+			return "", err
+		}
+		return e.GetDataValue("_MACHINE_ID")
+	}()
+	if err != nil {
+		zap.S().Errorf("cannot read source machine id, use instance id instead. %v", err)
+		return instanceID
+	}
+	return id
+}